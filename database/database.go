@@ -27,6 +27,44 @@ func InitDB() {
 
 	var err error
 
+	connectPostgres()
+
+	config := utils.GetConfig()
+	BoltDB, err = bbolt.Open(filepath.Join(config.ExecDir, "teldrive.db"), 0666, &bbolt.Options{
+		Timeout:    time.Second,
+		NoGrowSync: false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	KV, err = kv.New(kv.Options{Bucket: "teldrive", DB: BoltDB})
+
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		DB.Exec(`create collation if not exists numeric (provider = icu, locale = 'en@colnumeric=yes');`)
+		if utils.GetConfig().RunMigrations {
+			migrate()
+		}
+		sealSecrets()
+	}()
+}
+
+// InitPostgres connects to postgres only, for maintenance commands that run
+// alongside a live server holding the bbolt lock.
+func InitPostgres() {
+	connectPostgres()
+	if utils.GetConfig().RunMigrations {
+		migrate()
+	}
+}
+
+func connectPostgres() {
+
+	var err error
+
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags),
 		logger.Config{
@@ -61,26 +99,6 @@ func InitDB() {
 	sqlDB.SetMaxOpenConns(100)
 
 	sqlDB.SetConnMaxLifetime(time.Hour)
-	go func() {
-		DB.Exec(`create collation if not exists numeric (provider = icu, locale = 'en@colnumeric=yes');`)
-		if utils.GetConfig().RunMigrations {
-			migrate()
-		}
-	}()
-
-	config := utils.GetConfig()
-	BoltDB, err = bbolt.Open(filepath.Join(config.ExecDir, "teldrive.db"), 0666, &bbolt.Options{
-		Timeout:    time.Second,
-		NoGrowSync: false,
-	})
-	if err != nil {
-		panic(err)
-	}
-	KV, err = kv.New(kv.Options{Bucket: "teldrive", DB: BoltDB})
-
-	if err != nil {
-		panic(err)
-	}
 }
 
 func migrate() {
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.api_tokens (
+    id text NOT NULL PRIMARY KEY DEFAULT teldrive.generate_uid(16),
+    user_id bigint NOT NULL,
+    name text NOT NULL,
+    token_hash text NOT NULL UNIQUE,
+    scopes jsonb NOT NULL DEFAULT '[]'::jsonb,
+    path text NULL,
+    revoked boolean NOT NULL DEFAULT false,
+    last_used_at timestamp NULL,
+    expires_at timestamp NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    FOREIGN KEY (user_id) REFERENCES teldrive.users(user_id)
+);
+
+CREATE INDEX api_tokens_user_id_idx ON teldrive.api_tokens (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.api_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE teldrive.sessions ADD COLUMN id text NOT NULL DEFAULT teldrive.generate_uid(16);
+
+ALTER TABLE teldrive.sessions ADD COLUMN user_agent text NULL;
+
+ALTER TABLE teldrive.sessions ADD COLUMN ip text NULL;
+
+ALTER TABLE teldrive.sessions ADD COLUMN last_seen_at timestamp NULL;
+
+ALTER TABLE teldrive.sessions ADD COLUMN expires_at timestamp NULL;
+
+-- existing logins get the default SESSION_MAX_LIFETIME, their cookies carry no
+-- session id and are looked up by hash until they expire
+UPDATE teldrive.sessions SET expires_at = created_at + interval '90 days' WHERE expires_at IS NULL;
+
+CREATE UNIQUE INDEX sessions_id_idx ON teldrive.sessions (id);
+
+CREATE INDEX sessions_user_id_idx ON teldrive.sessions (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.sessions_id_idx;
+DROP INDEX IF EXISTS teldrive.sessions_user_id_idx;
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS id;
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS ip;
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.jwt_keys (
+    id text NOT NULL PRIMARY KEY,
+    secret text NOT NULL,
+    active boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    retired_at timestamp NULL
+);
+
+CREATE UNIQUE INDEX jwt_keys_active_idx ON teldrive.jwt_keys (active) WHERE (active);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.jwt_keys;
+-- +goose StatementEnd
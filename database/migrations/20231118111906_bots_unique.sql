@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+DELETE FROM teldrive.bots a USING teldrive.bots b
+WHERE a.ctid < b.ctid AND a.user_id = b.user_id AND a.bot_id = b.bot_id
+AND a.channel_id IS NOT DISTINCT FROM b.channel_id;
+
+CREATE UNIQUE INDEX bots_user_bot_channel_un ON teldrive.bots (user_id, bot_id, channel_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS teldrive.bots_user_bot_channel_un;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+
+ALTER TABLE teldrive.users ADD COLUMN disabled boolean NOT NULL DEFAULT false;
+
+ALTER TABLE teldrive.sessions ADD COLUMN verified boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+
+ALTER TABLE teldrive.users DROP COLUMN IF EXISTS disabled;
+
+ALTER TABLE teldrive.sessions DROP COLUMN IF EXISTS verified;
@@ -0,0 +1,11 @@
+-- +goose Up
+
+ALTER TABLE teldrive.users ADD COLUMN quota_bytes bigint NULL;
+
+ALTER TABLE teldrive.users ADD COLUMN quota_files bigint NULL;
+
+-- +goose Down
+
+ALTER TABLE teldrive.users DROP COLUMN IF EXISTS quota_bytes;
+
+ALTER TABLE teldrive.users DROP COLUMN IF EXISTS quota_files;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.access_control (
+    user_id bigint NOT NULL PRIMARY KEY,
+    role text NOT NULL DEFAULT 'user',
+    created_by bigint NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE TABLE teldrive.invitations (
+    id text NOT NULL PRIMARY KEY DEFAULT teldrive.generate_uid(16),
+    code_hash text NOT NULL UNIQUE,
+    role text NOT NULL DEFAULT 'user',
+    created_by bigint NOT NULL,
+    expires_at timestamp NULL,
+    used_by bigint NULL,
+    used_at timestamp NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.access_control;
+DROP TABLE IF EXISTS teldrive.invitations;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.user_mfa (
+    user_id bigint NOT NULL PRIMARY KEY,
+    secret text NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    recovery_codes jsonb NULL,
+    enabled_at timestamp NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.user_mfa;
+-- +goose StatementEnd
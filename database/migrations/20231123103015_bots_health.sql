@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE teldrive.bots ADD COLUMN IF NOT EXISTS disabled_reason text NULL;
+ALTER TABLE teldrive.bots ADD COLUMN IF NOT EXISTS disabled_at timestamp NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.bots DROP COLUMN IF EXISTS disabled_reason;
+ALTER TABLE teldrive.bots DROP COLUMN IF EXISTS disabled_at;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.upload_jobs (
+    id text NOT NULL PRIMARY KEY DEFAULT teldrive.generate_uid(16),
+    upload_id text NOT NULL,
+    user_id bigint NOT NULL,
+    name text NOT NULL,
+    part_no integer NOT NULL DEFAULT 1,
+    total_parts integer NOT NULL DEFAULT 1,
+    channel_id bigint NOT NULL,
+    size bigint NOT NULL,
+    path text NOT NULL,
+    status text NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    uploaded_bytes bigint NOT NULL DEFAULT 0,
+    error text NULL,
+    next_attempt_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX upload_jobs_upload_id_idx ON teldrive.upload_jobs (upload_id);
+CREATE INDEX upload_jobs_status_idx ON teldrive.upload_jobs (status, next_attempt_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.upload_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE teldrive.uploads ADD COLUMN mime_type text NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS mime_type;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.idempotency_keys (
+    user_id bigint NOT NULL,
+    key text NOT NULL,
+    request_hash text NOT NULL,
+    status_code integer NULL,
+    content_type text NULL,
+    response bytea NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON teldrive.idempotency_keys (created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.idempotency_keys;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE teldrive.files ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION teldrive.bump_file_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER files_version_trigger
+BEFORE UPDATE ON teldrive.files
+FOR EACH ROW EXECUTE FUNCTION teldrive.bump_file_version();
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS files_version_trigger ON teldrive.files;
+DROP FUNCTION IF EXISTS teldrive.bump_file_version();
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE teldrive.copy_jobs (
+    id text NOT NULL PRIMARY KEY DEFAULT teldrive.generate_uid(16),
+    user_id bigint NOT NULL,
+    items jsonb NOT NULL,
+    name text NULL,
+    destination text NOT NULL,
+    conflict text NOT NULL DEFAULT 'fail',
+    status text NOT NULL DEFAULT 'running',
+    total_files integer NOT NULL DEFAULT 0,
+    copied_files integer NOT NULL DEFAULT 0,
+    skipped_files integer NOT NULL DEFAULT 0,
+    failed_files integer NOT NULL DEFAULT 0,
+    failures jsonb NOT NULL DEFAULT '[]'::jsonb,
+    error text NULL,
+    created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+    updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX copy_jobs_user_id_idx ON teldrive.copy_jobs (user_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.copy_jobs;
+-- +goose StatementEnd
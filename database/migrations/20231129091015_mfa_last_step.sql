@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE teldrive.user_mfa ADD COLUMN last_step bigint NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.user_mfa DROP COLUMN IF EXISTS last_step;
+-- +goose StatementEnd
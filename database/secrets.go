@@ -0,0 +1,102 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/kv"
+	"github.com/divyam234/teldrive/utils/secret"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// sealSecrets brings data written by older versions up to date: bot sessions
+// keyed by raw token move to digest keys, and once MASTER_KEY is set every
+// plaintext session string, bot token, jwt key and bot session is encrypted.
+// It is idempotent and runs after migrations on every start.
+func sealSecrets() {
+	if err := sealBotSessions(); err != nil {
+		utils.Logger.Error("failed to seal bot sessions", zap.Error(err))
+	}
+
+	if !secret.Enabled() {
+		return
+	}
+
+	for _, target := range [][2]string{{"sessions", "session"}, {"bots", "token"}, {"jwt_keys", "secret"}} {
+		if err := sealColumn(target[0], target[1]); err != nil {
+			utils.Logger.Error("failed to seal secrets", zap.String("table", target[0]), zap.Error(err))
+		}
+	}
+}
+
+func sealColumn(table, column string) error {
+	var values []string
+
+	if err := DB.Raw(fmt.Sprintf("select distinct %s from teldrive.%s where %s not like 'enc:%%'", column, table, column)).
+		Scan(&values).Error; err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		sealed, err := secret.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		if err := DB.Exec(fmt.Sprintf("update teldrive.%s set %s = ? where %s = ?", table, column, column), sealed, value).
+			Error; err != nil {
+			return err
+		}
+	}
+
+	if len(values) > 0 {
+		utils.Logger.Info("sealed secrets", zap.String("table", table), zap.Int("count", len(values)))
+	}
+	return nil
+}
+
+func sealBotSessions() error {
+	prefix := []byte("botsession:")
+
+	return BoltDB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("teldrive"))
+		if bucket == nil {
+			return nil
+		}
+
+		updates := map[string][]byte{}
+		stale := [][]byte{}
+
+		c := bucket.Cursor()
+
+		for key, value := c.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = c.Next() {
+			newKey := string(key)
+			if token := strings.TrimPrefix(string(key), string(prefix)); strings.Contains(token, ":") {
+				newKey = kv.BotSessionKey(token)
+				stale = append(stale, append([]byte{}, key...))
+			} else if secret.IsEncrypted(value) || !secret.Enabled() {
+				continue
+			}
+			sealed, err := secret.EncryptBytes(append([]byte{}, value...))
+			if err != nil {
+				return err
+			}
+			updates[newKey] = sealed
+		}
+
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		for key, value := range updates {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,21 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"mime"
+	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/divyam234/teldrive/database"
 	"github.com/divyam234/teldrive/routes"
+	"github.com/divyam234/teldrive/services"
 	"github.com/divyam234/teldrive/ui"
 	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/auth"
 
 	"github.com/divyam234/cors"
 	"github.com/divyam234/teldrive/utils/cache"
 	"github.com/divyam234/teldrive/utils/cron"
+	"github.com/divyam234/teldrive/utils/tgc"
 	"github.com/gin-gonic/gin"
 	"github.com/go-co-op/gocron"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -28,8 +38,17 @@ func main() {
 
 	utils.InitializeLogger()
 
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys()
+		return
+	}
+
 	database.InitDB()
 
+	if err := auth.LoadKeys(database.DB); err != nil {
+		utils.Logger.Error("failed to load jwt keys", zap.Error(err))
+	}
+
 	cache.InitCache()
 
 	scheduler := gocron.NewScheduler(time.UTC)
@@ -38,17 +57,33 @@ func main() {
 
 	scheduler.Every(12).Hour().Do(cron.UploadCleanJob)
 
+	scheduler.Every(1).Hour().Do(cron.IdempotencyCleanJob)
+
+	scheduler.Every(5).Minute().Do(cron.CopyJobsCleanJob)
+
+	scheduler.Every(1).Minute().Do(auth.LoadKeys, database.DB)
+
+	scheduler.Every(1).Minute().Do(tgc.UserClients.Maintain)
+
 	scheduler.StartAsync()
 
-	router.Use(cors.New(cors.Config{
+	services.StartIngest()
+
+	corsHandler := cors.New(cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Authorization", "Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Authorization", "Content-Length", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "If-Match"},
+		ExposeHeaders:    []string{"ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			return true
-		},
-		MaxAge: 12 * time.Hour,
-	}))
+		AllowOriginFunc:  utils.OriginAllowed,
+		MaxAge:           12 * time.Hour,
+	})
+
+	router.Use(func(c *gin.Context) {
+		if utils.SameOrigin(c.Request) {
+			return
+		}
+		corsHandler(c)
+	})
 
 	mime.AddExtensionType(".js", "application/javascript")
 
@@ -61,9 +96,49 @@ func main() {
 	config := utils.GetConfig()
 	certDir := filepath.Join(config.ExecDir, "sslcerts")
 	ok, _ := utils.PathExists(certDir)
-	if ok && config.Https {
-		router.RunTLS(fmt.Sprintf(":%d", config.Port), filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem"))
-	} else {
-		router.Run(fmt.Sprintf(":%d", config.Port))
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Port),
+		Handler: router,
 	}
+
+	go func() {
+		var err error
+		if ok && config.Https {
+			err = srv.ListenAndServeTLS(filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem"))
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.Logger.Fatal("server failed", zap.Error(err))
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	utils.Logger.Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	srv.Shutdown(ctx)
+	scheduler.Stop()
+	services.StopIngest()
+	services.StopCopyJobs()
+	tgc.UserClients.Close()
+	tgc.StreamWorkers.Close()
+}
+
+func rotateKeys() {
+	database.InitPostgres()
+
+	key, err := auth.RotateKeys(database.DB, utils.GetConfig().SessionMaxLifetime)
+
+	if err != nil {
+		utils.Logger.Fatal("failed to rotate jwt keys", zap.Error(err))
+	}
+
+	utils.Logger.Info("rotated jwt keys", zap.String("kid", key.ID))
 }
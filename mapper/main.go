@@ -16,6 +16,7 @@ func MapFileToFileOut(file models.File) schemas.FileOut {
 		Starred:   file.Starred,
 		ParentID:  file.ParentID,
 		UpdatedAt: file.UpdatedAt,
+		Version:   file.Version,
 	}
 }
 
@@ -51,6 +52,94 @@ func MapUploadSchema(in *models.Upload) *schemas.UploadPartOut {
 		ChannelID: in.ChannelID,
 		PartNo:    in.PartNo,
 		Size:      in.Size,
+		MimeType:  in.MimeType,
 	}
 	return out
 }
+
+func MapUploadJobSchema(in *models.UploadJob) *schemas.UploadJobOut {
+	out := &schemas.UploadJobOut{
+		ID:            in.ID,
+		Name:          in.Name,
+		PartNo:        in.PartNo,
+		TotalParts:    in.TotalParts,
+		Size:          in.Size,
+		Status:        in.Status,
+		Attempts:      in.Attempts,
+		UploadedBytes: in.UploadedBytes,
+		CreatedAt:     in.CreatedAt,
+		UpdatedAt:     in.UpdatedAt,
+	}
+	if in.Error != nil {
+		out.Error = *in.Error
+	}
+	return out
+}
+
+func MapCopyJobSchema(in *models.CopyJob) *schemas.CopyJobOut {
+	out := &schemas.CopyJobOut{
+		ID:           in.ID,
+		Items:        in.Items,
+		Destination:  in.Destination,
+		Conflict:     in.Conflict,
+		Status:       in.Status,
+		TotalFiles:   in.TotalFiles,
+		CopiedFiles:  in.CopiedFiles,
+		SkippedFiles: in.SkippedFiles,
+		FailedFiles:  in.FailedFiles,
+		CreatedAt:    in.CreatedAt,
+		UpdatedAt:    in.UpdatedAt,
+	}
+	for _, failure := range in.Failures {
+		out.Failures = append(out.Failures, schemas.CopyFailure{ID: failure.ID, Name: failure.Name, Error: failure.Error})
+	}
+	if in.Error != nil {
+		out.Error = *in.Error
+	}
+	return out
+}
+
+func MapAPITokenSchema(in *models.APIToken) *schemas.APITokenOut {
+	return &schemas.APITokenOut{
+		ID:         in.ID,
+		Name:       in.Name,
+		Scopes:     in.Scopes,
+		Path:       in.Path,
+		Revoked:    in.Revoked,
+		LastUsedAt: in.LastUsedAt,
+		ExpiresAt:  in.ExpiresAt,
+		CreatedAt:  in.CreatedAt,
+	}
+}
+
+func MapSessionSchema(in *models.Session) *schemas.SessionOut {
+	return &schemas.SessionOut{
+		ID:         in.ID,
+		UserAgent:  in.UserAgent,
+		IP:         in.IP,
+		LastSeenAt: in.LastSeenAt,
+		ExpiresAt:  in.ExpiresAt,
+		CreatedAt:  in.CreatedAt,
+	}
+}
+
+func MapAccessSchema(in *models.AccessControl) *schemas.AccessOut {
+	return &schemas.AccessOut{
+		UserID:    in.UserID,
+		Role:      in.Role,
+		CreatedBy: in.CreatedBy,
+		CreatedAt: in.CreatedAt,
+	}
+}
+
+func MapInvitationSchema(in *models.Invitation) *schemas.InvitationOut {
+	return &schemas.InvitationOut{
+		ID:        in.ID,
+		Role:      in.Role,
+		CreatedBy: in.CreatedBy,
+		ExpiresAt: in.ExpiresAt,
+		UsedBy:    in.UsedBy,
+		UsedAt:    in.UsedAt,
+		CreatedAt: in.CreatedAt,
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type AccessControl struct {
+	UserID    int64     `gorm:"type:bigint;primaryKey"`
+	Role      string    `gorm:"type:text;default:user"`
+	CreatedBy *int64    `gorm:"type:bigint"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
+
+func (AccessControl) TableName() string {
+	return "teldrive.access_control"
+}
+
+type Invitation struct {
+	ID        string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	CodeHash  string     `gorm:"type:text;not null"`
+	Role      string     `gorm:"type:text;default:user"`
+	CreatedBy int64      `gorm:"type:bigint;not null"`
+	ExpiresAt *time.Time `gorm:"type:timestamp"`
+	UsedBy    *int64     `gorm:"type:bigint"`
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
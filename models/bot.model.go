@@ -1,9 +1,13 @@
 package models
 
+import "time"
+
 type Bot struct {
-	Token       string `gorm:"type:text;primaryKey"`
-	UserID      int64  `gorm:"type:bigint"`
-	BotID       int64  `gorm:"type:bigint"`
-	BotUserName string `gorm:"type:text"`
-	ChannelID   int64  `gorm:"type:bigint"`
+	Token          string     `gorm:"type:text;primaryKey"`
+	UserID         int64      `gorm:"type:bigint"`
+	BotID          int64      `gorm:"type:bigint"`
+	BotUserName    string     `gorm:"type:text"`
+	ChannelID      int64      `gorm:"type:bigint"`
+	DisabledReason *string    `gorm:"type:text"`
+	DisabledAt     *time.Time `gorm:"type:timestamp"`
 }
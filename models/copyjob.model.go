@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+type CopyJob struct {
+	ID           string       `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserId       int64        `gorm:"type:bigint"`
+	Items        CopyItems    `gorm:"type:jsonb"`
+	Name         *string      `gorm:"type:text"`
+	Destination  string       `gorm:"type:text"`
+	Conflict     string       `gorm:"type:text"`
+	Status       string       `gorm:"type:text"`
+	TotalFiles   int          `gorm:"type:integer"`
+	CopiedFiles  int          `gorm:"type:integer"`
+	SkippedFiles int          `gorm:"type:integer"`
+	FailedFiles  int          `gorm:"type:integer"`
+	Failures     CopyFailures `gorm:"type:jsonb"`
+	Error        *string      `gorm:"type:text"`
+	CreatedAt    time.Time    `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt    time.Time    `gorm:"default:timezone('utc'::text, now())"`
+}
+
+// CopyItems are the ids of the files and folders selected for copying.
+type CopyItems []string
+
+func (a CopyItems) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *CopyItems) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
+
+type CopyFailures []CopyFailure
+type CopyFailure struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+func (a CopyFailures) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *CopyFailures) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
@@ -20,6 +20,7 @@ type File struct {
 	ParentID  string    `gorm:"type:text;index"`
 	Parts     *Parts    `gorm:"type:jsonb"`
 	ChannelID *int64    `gorm:"type:bigint"`
+	Version   int       `gorm:"type:integer;default:1"`
 	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
 	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
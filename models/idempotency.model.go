@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type IdempotencyKey struct {
+	UserID      int64     `gorm:"type:bigint;primaryKey"`
+	Key         string    `gorm:"type:text;primaryKey"`
+	RequestHash string    `gorm:"type:text"`
+	StatusCode  *int      `gorm:"type:integer"`
+	ContentType *string   `gorm:"type:text"`
+	Response    []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// scanJSON decodes a jsonb column into dest. NULL leaves dest untouched.
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", value, dest)
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+type JWTKey struct {
+	ID        string     `gorm:"type:text;primaryKey"`
+	Secret    string     `gorm:"type:text;not null"`
+	Active    bool       `gorm:"type:boolean;default:false"`
+	CreatedAt time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	RetiredAt *time.Time `gorm:"type:timestamp"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+type UserMFA struct {
+	UserID        int64         `gorm:"type:bigint;primaryKey"`
+	Secret        string        `gorm:"type:text;not null"`
+	Enabled       bool          `gorm:"type:boolean;default:false"`
+	RecoveryCodes RecoveryCodes `gorm:"type:jsonb"`
+	LastStep      int64         `gorm:"type:bigint;default:0"`
+	EnabledAt     *time.Time    `gorm:"type:timestamp"`
+	CreatedAt     time.Time     `gorm:"default:timezone('utc'::text, now())"`
+}
+
+func (UserMFA) TableName() string {
+	return "teldrive.user_mfa"
+}
+
+// RecoveryCodes holds sha256 hashes of the unused recovery codes.
+type RecoveryCodes []string
+
+func (a RecoveryCodes) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *RecoveryCodes) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
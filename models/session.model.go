@@ -5,8 +5,14 @@ import (
 )
 
 type Session struct {
-	UserId    int64     `gorm:"type:bigint;primaryKey"`
-	Hash      string    `gorm:"type:text"`
-	Session   string    `gorm:"type:text"`
-	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	ID         string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserId     int64      `gorm:"type:bigint"`
+	Hash       string     `gorm:"type:text"`
+	Session    string     `gorm:"type:text"`
+	UserAgent  string     `gorm:"type:text"`
+	IP         string     `gorm:"type:text"`
+	LastSeenAt *time.Time `gorm:"type:timestamp"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp"`
+	Verified   bool       `gorm:"type:boolean;default:false"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
 }
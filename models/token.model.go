@@ -0,0 +1,30 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+type APIToken struct {
+	ID         string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID     int64      `gorm:"type:bigint;not null"`
+	Name       string     `gorm:"type:text;not null"`
+	TokenHash  string     `gorm:"type:text;not null"`
+	Scopes     Scopes     `gorm:"type:jsonb"`
+	Path       string     `gorm:"type:text"`
+	Revoked    bool       `gorm:"type:boolean;default:false"`
+	LastUsedAt *time.Time `gorm:"type:timestamp"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
+
+type Scopes []string
+
+func (a Scopes) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *Scopes) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
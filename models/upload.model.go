@@ -14,5 +14,6 @@ type Upload struct {
 	PartId     int       `gorm:"type:integer"`
 	ChannelID  int64     `gorm:"type:bigint"`
 	Size       int64     `gorm:"type:bigint"`
+	MimeType   *string   `gorm:"type:text"`
 	CreatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
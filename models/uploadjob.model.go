@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+type UploadJob struct {
+	ID            string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UploadId      string    `gorm:"type:text"`
+	UserId        int64     `gorm:"type:bigint"`
+	Name          string    `gorm:"type:text"`
+	PartNo        int       `gorm:"type:integer"`
+	TotalParts    int       `gorm:"type:integer"`
+	ChannelID     int64     `gorm:"type:bigint"`
+	Size          int64     `gorm:"type:bigint"`
+	Path          string    `gorm:"type:text"`
+	Status        string    `gorm:"type:text"`
+	Attempts      int       `gorm:"type:integer"`
+	UploadedBytes int64     `gorm:"type:bigint"`
+	Error         *string   `gorm:"type:text"`
+	NextAttemptAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	CreatedAt     time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt     time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
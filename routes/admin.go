@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addAdminRoutes(rg *gin.RouterGroup) {
+	r := rg.Group("/admin")
+	r.Use(Authmiddleware, AdminMiddleware)
+	adminService := services.AdminService{Db: database.DB}
+	accessService := services.AccessService{Db: database.DB}
+
+	r.GET("/users", func(c *gin.Context) {
+		res, err := adminService.ListUsers(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.PATCH("/users/:userID", func(c *gin.Context) {
+		res, err := adminService.UpdateUser(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/users/:userID/sessions", func(c *gin.Context) {
+		res, err := adminService.ListUserSessions(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/users/:userID/sessions", func(c *gin.Context) {
+		res, err := adminService.LogoutUser(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/users/:userID/mfa", func(c *gin.Context) {
+		res, err := adminService.ResetUserMFA(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/users/:userID/bots", func(c *gin.Context) {
+		res, err := adminService.ListUserBots(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/files/mime-backfill", func(c *gin.Context) {
+		res, err := adminService.BackfillMimeTypes(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusAccepted, res)
+	})
+
+	r.GET("/access", func(c *gin.Context) {
+		res, err := accessService.ListAccess(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.PUT("/access/:userID", func(c *gin.Context) {
+		res, err := accessService.UpdateAccess(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/access/:userID", func(c *gin.Context) {
+		res, err := accessService.RemoveAccess(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/invitations", func(c *gin.Context) {
+		res, err := accessService.ListInvitations(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/invitations", func(c *gin.Context) {
+		res, err := accessService.CreateInvitation(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusCreated, res)
+	})
+
+	r.DELETE("/invitations/:id", func(c *gin.Context) {
+		res, err := accessService.DeleteInvitation(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+}
@@ -40,6 +40,38 @@ func addAuthRoutes(rg *gin.RouterGroup) {
 
 	r.GET("/ws", authService.HandleMultipleLogin)
 
+	r.POST("/session/export", Authmiddleware, func(c *gin.Context) {
+		res, err := authService.ExportSession(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/sessions", Authmiddleware, func(c *gin.Context) {
+
+		res, err := authService.ListSessions(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/sessions/:id", Authmiddleware, func(c *gin.Context) {
+
+		res, err := authService.RevokeSession(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
 	r.GET("/session", func(c *gin.Context) {
 
 		session := authService.GetSession(c)
@@ -46,6 +46,8 @@ func addFileRoutes(rg *gin.RouterGroup) {
 			return
 		}
 
+		c.Header("ETag", services.FileETag(res.Version))
+
 		c.JSON(http.StatusOK, res)
 	})
 
@@ -58,6 +60,8 @@ func addFileRoutes(rg *gin.RouterGroup) {
 			return
 		}
 
+		c.Header("ETag", services.FileETag(res.Version))
+
 		c.JSON(http.StatusOK, res)
 	})
 
@@ -121,7 +125,48 @@ func addFileRoutes(rg *gin.RouterGroup) {
 
 	r.POST("/copy", Authmiddleware, func(c *gin.Context) {
 
-		res, err := fileService.CopyFile(c)
+		res, job, err := fileService.CopyFile(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+
+		if job != nil {
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/copy/jobs", Authmiddleware, func(c *gin.Context) {
+
+		res, err := fileService.ListCopyJobs(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.GET("/copy/jobs/:id", Authmiddleware, func(c *gin.Context) {
+
+		res, err := fileService.GetCopyJob(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.DELETE("/copy/jobs/:id", Authmiddleware, func(c *gin.Context) {
+
+		res, err := fileService.CancelCopyJob(c)
 
 		if err != nil {
 			c.AbortWithError(err.Code, err.Error)
@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/services"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyBodyLimit is the largest request body accepted with an
+// idempotency key and the largest response stored for replay. Uploads are
+// retried by part instead.
+const idempotencyBodyLimit = 1 << 20
+
+var errBodyTooLarge = errors.New("request body too large for an idempotency key")
+
+const maxIdempotencyKeyLen = 255
+
+// responseRecorder keeps a copy of the response written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseRecorder) record(b []byte) {
+	if w.overflow || w.body.Len()+len(b) > idempotencyBodyLimit {
+		w.overflow = true
+		return
+	}
+	w.body.Write(b)
+}
+
+// idempotent runs the rest of the chain once per Idempotency-Key. The first
+// response to a mutating request is stored and replayed for retries with the
+// same key, a retry while the first request still runs gets 409 and reusing
+// a key for a different request gets 422. Server errors are not stored so
+// the request can be retried.
+func idempotent(c *gin.Context) {
+	key := c.GetHeader(idempotencyHeader)
+
+	method := c.Request.Method
+
+	if key == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		c.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key too long"})
+		c.Abort()
+		return
+	}
+
+	val, _ := c.Get("jwtUser")
+	userId, _ := strconv.ParseInt(val.(*types.JWTClaims).Subject, 10, 64)
+
+	requestHash, err := fingerprint(c)
+
+	if errors.Is(err, errBodyTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		c.Abort()
+		return
+	}
+
+	record, claimed, err := services.ClaimIdempotencyKey(userId, key, requestHash)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check idempotency key"})
+		c.Abort()
+		return
+	}
+
+	if !claimed {
+		switch {
+		case record.RequestHash != requestHash:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key reused with a different request"})
+		case record.StatusCode == nil:
+			c.JSON(http.StatusConflict, gin.H{"error": "request with this idempotency key still in progress"})
+		default:
+			contentType := ""
+			if record.ContentType != nil {
+				contentType = *record.ContentType
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(*record.StatusCode, contentType, record.Response)
+		}
+		c.Abort()
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+
+	c.Writer = recorder
+
+	stored := false
+
+	// a panic skips the rest, free the key so retries aren't stuck
+	defer func() {
+		if !stored {
+			if err := services.ReleaseIdempotencyKey(userId, key); err != nil {
+				utils.Logger.Error("failed to release idempotency key", zap.Error(err))
+			}
+		}
+	}()
+
+	c.Next()
+
+	c.Writer = recorder.ResponseWriter
+
+	status := recorder.Status()
+
+	body := recorder.body.Bytes()
+
+	contentType := recorder.Header().Get("Content-Type")
+
+	// errors are rendered by gin.ErrorLogger once the chain unwinds
+	if recorder.body.Len() == 0 && len(c.Errors) > 0 {
+		body, _ = json.Marshal(c.Errors.JSON())
+		contentType = "application/json; charset=utf-8"
+	}
+
+	if status >= http.StatusInternalServerError || recorder.overflow {
+		return
+	}
+
+	if err := services.CompleteIdempotencyKey(userId, key, status, contentType, body); err != nil {
+		utils.Logger.Error("failed to store idempotency key", zap.Error(err))
+		return
+	}
+
+	stored = true
+}
+
+// fingerprint hashes the parts of the request that identify it, bodies over
+// idempotencyBodyLimit are refused. The body is restored for the handlers.
+func fingerprint(c *gin.Context) (string, error) {
+	if c.Request.ContentLength > idempotencyBodyLimit {
+		return "", errBodyTooLarge
+	}
+
+	h := sha256.New()
+
+	io.WriteString(h, c.Request.Method+" "+c.Request.URL.Path+"?"+c.Request.URL.RawQuery+"\n")
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, idempotencyBodyLimit+1))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(body) > idempotencyBodyLimit {
+		return "", errBodyTooLarge
+	}
+
+	h.Write(body)
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
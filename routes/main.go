@@ -11,7 +11,8 @@ import (
 
 func AddRoutes(router *gin.Engine) {
 	api := router.Group("/api")
-	api.GET("/bbolt", Authmiddleware, func(c *gin.Context) {
+	api.Use(RateLimitMiddleware, CSRFMiddleware)
+	api.GET("/bbolt", Authmiddleware, AdminMiddleware, func(c *gin.Context) {
 		err := database.BoltDB.View(func(tx *bbolt.Tx) error {
 			c.Writer.Header().Set("Content-Type", "application/octet-stream")
 			c.Writer.Header().Set("Content-Disposition", `attachment; filename="teldrive.db"`)
@@ -28,4 +29,6 @@ func AddRoutes(router *gin.Engine) {
 	addFileRoutes(api)
 	addUploadRoutes(api)
 	addUserRoutes(api)
+	addTokenRoutes(api)
+	addAdminRoutes(api)
 }
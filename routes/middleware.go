@@ -1,16 +1,33 @@
 package routes
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/services"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
 	"github.com/divyam234/teldrive/utils/auth"
+	"github.com/divyam234/teldrive/utils/throttle"
 	"github.com/gin-gonic/gin"
 	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/thoas/go-funk"
 )
 
 func Authmiddleware(c *gin.Context) {
 
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		tokenAuth(c, strings.TrimPrefix(header, "Bearer "))
+		return
+	}
+
 	cookie, err := c.Request.Cookie("user-session")
 
 	if err != nil {
@@ -35,8 +52,260 @@ func Authmiddleware(c *gin.Context) {
 		return
 	}
 
+	var session *models.Session
+
+	// cookies issued before sessions had ids only carry the session hash
+	if jwePayload.ID == "" {
+		session, err = services.GetSessionByHash(jwePayload.Hash)
+		if err == nil {
+			jwePayload.ID = session.ID
+		}
+	} else {
+		session, err = services.GetSessionByID(jwePayload.ID)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+		c.Abort()
+		return
+	}
+
+	if session.ExpiresAt == nil || session.ExpiresAt.Before(now) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+		c.Abort()
+		return
+	}
+
+	if services.IsUserDisabled(session.UserId) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user disabled"})
+		c.Abort()
+		return
+	}
+
+	services.TouchSession(session, c.ClientIP(), c.Request.UserAgent())
+
 	c.Set("jwtUser", jwePayload)
 
+	if !allowRequest(c, "user:"+jwePayload.Subject) {
+		return
+	}
+
+	idempotent(c)
+
+}
+
+func tokenAuth(c *gin.Context, bearer string) {
+
+	token, err := services.GetAPITokenByHash(services.HashAPIToken(bearer))
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid api token"})
+		c.Abort()
+		return
+	}
+
+	if token.Revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "api token revoked"})
+		c.Abort()
+		return
+	}
+
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now().UTC()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "api token expired"})
+		c.Abort()
+		return
+	}
+
+	if !tokenAllows(token, c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "api token scope does not allow this request"})
+		c.Abort()
+		return
+	}
+
+	if services.IsUserDisabled(token.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user disabled"})
+		c.Abort()
+		return
+	}
+
+	session, err := services.GetLatestSession(token.UserID)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no active session for token owner"})
+		c.Abort()
+		return
+	}
+
+	services.TouchAPIToken(token)
+
+	c.Set("jwtUser", &types.JWTClaims{
+		Claims:    jwt.Claims{Subject: strconv.FormatInt(token.UserID, 10)},
+		TgSession: session.Session,
+		Hash:      session.Hash,
+	})
+
+	c.Set("apiToken", token)
+
+	if !allowRequest(c, "user:"+strconv.FormatInt(token.UserID, 10)) {
+		return
+	}
+
+	idempotent(c)
+}
+
+// rateGroup maps a route to its rate limit group, the segment after /api.
+// Streaming has its own group so download managers opening many ranged
+// connections are not throttled with the rest of the api.
+func rateGroup(path string) string {
+	if path == "/api/files/:fileID/:fileName" {
+		return "stream"
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	if segments[0] == "" {
+		return "default"
+	}
+	return segments[0]
+}
+
+func allowRequest(c *gin.Context, key string) bool {
+	group := rateGroup(c.FullPath())
+
+	limiter := throttle.Group(group)
+
+	if limiter == nil {
+		return true
+	}
+
+	ok, wait := limiter.Allow(group + ":" + key)
+
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+		c.Abort()
+	}
+	return ok
+}
+
+// RateLimitMiddleware limits requests per client ip. Authmiddleware applies
+// the same group limits per user once the user is known.
+func RateLimitMiddleware(c *gin.Context) {
+	if !allowRequest(c, "ip:"+c.ClientIP()) {
+		return
+	}
+	c.Next()
+}
+
+// AdminMiddleware must run after Authmiddleware. Admin routes are only
+// reachable with a login session, never with an api token.
+func AdminMiddleware(c *gin.Context) {
+	if _, ok := c.Get("apiToken"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin routes require a login session"})
+		c.Abort()
+		return
+	}
+
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+	userId, _ := strconv.ParseInt(jwtUser.Subject, 10, 64)
+
+	if !services.IsAdmin(userId) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		c.Abort()
+		return
+	}
+
+	// sessions from before logins were checked with Telegram may name any user
+	if session, err := services.GetSessionByID(jwtUser.ID); err != nil || !session.Verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access requires a new login"})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+const csrfCookieName = "csrf-token"
+
+// csrfGetRoutes are GET routes with side effects which need the same
+// protection as mutating methods.
+var csrfGetRoutes = []string{
+	"/api/auth/logout",
+	"/api/users/bots/revoke",
+}
+
+// CSRFMiddleware implements the double submit cookie pattern. Every response
+// carries a readable csrf cookie and cookie authenticated requests that change
+// state must echo it in the X-CSRF-Token header. Bearer token requests carry
+// no ambient credentials and are exempt.
+func CSRFMiddleware(c *gin.Context) {
+	token, err := c.Cookie(csrfCookieName)
+
+	if err != nil || token == "" {
+		buf := make([]byte, 32)
+		rand.Read(buf)
+		token = hex.EncodeToString(buf)
+		config := utils.GetConfig()
+		if config.CookieSameSite {
+			c.SetSameSite(http.SameSiteLaxMode)
+		} else {
+			c.SetSameSite(http.SameSiteNoneMode)
+		}
+		c.SetCookie(csrfCookieName, token, 0, "/", c.Request.Host, config.Https, false)
+	}
+
+	method := c.Request.Method
+
+	safe := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+
+	if safe && !funk.ContainsString(csrfGetRoutes, c.FullPath()) {
+		c.Next()
+		return
+	}
+
+	if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+		c.Next()
+		return
+	}
+
+	if _, err := c.Cookie("user-session"); err != nil {
+		c.Next()
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-CSRF-Token")), []byte(token)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid csrf token"})
+		c.Abort()
+		return
+	}
+
 	c.Next()
+}
+
+// uploadRoutes are the only mutating routes an upload-only token may call.
+var uploadRoutes = []string{
+	"/api/uploads/parts",
+	"/api/uploads/:id",
+	"/api/uploads/:id/complete",
+	"/api/files",
+	"/api/files/makedir",
+}
+
+func tokenAllows(token *models.APIToken, c *gin.Context) bool {
+	if funk.ContainsString(token.Scopes, types.ScopeWrite) {
+		return true
+	}
+
+	method := c.Request.Method
+
+	if method == http.MethodGet || method == http.MethodHead {
+		return funk.ContainsString(token.Scopes, types.ScopeRead) ||
+			(funk.ContainsString(token.Scopes, types.ScopeUpload) && (strings.HasPrefix(c.FullPath(), "/api/uploads/:id") ||
+				c.FullPath() == "/api/users/events"))
+	}
+
+	if method == http.MethodPost && funk.ContainsString(token.Scopes, types.ScopeUpload) {
+		return funk.ContainsString(uploadRoutes, c.FullPath())
+	}
 
+	return false
 }
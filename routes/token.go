@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addTokenRoutes(rg *gin.RouterGroup) {
+	r := rg.Group("/tokens")
+	r.Use(Authmiddleware)
+	tokenService := services.TokenService{Db: database.DB}
+
+	r.GET("", func(c *gin.Context) {
+		res, err := tokenService.ListTokens(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("", func(c *gin.Context) {
+		res, err := tokenService.CreateToken(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusCreated, res)
+	})
+
+	r.DELETE("/:id", func(c *gin.Context) {
+		res, err := tokenService.RevokeToken(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/services"
 
 	"github.com/gin-gonic/gin"
@@ -40,8 +41,59 @@ func addUploadRoutes(rg *gin.RouterGroup) {
 		c.JSON(http.StatusOK, res)
 	})
 
+	r.GET("/:id/status", func(c *gin.Context) {
+
+		res, err := uploadService.GetUploadStatus(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/:id/complete", func(c *gin.Context) {
+
+		res, err := uploadService.CompleteUpload(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	})
+
 	r.POST("/:id", func(c *gin.Context) {
 
+		var uploadQuery schemas.UploadQuery
+
+		if err := c.ShouldBindQuery(&uploadQuery); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		if uploadQuery.Async {
+			res, err := uploadService.StageUpload(c)
+			if err != nil {
+				c.AbortWithError(err.Code, err.Error)
+				return
+			}
+			c.JSON(http.StatusAccepted, res)
+			return
+		}
+
+		if uploadQuery.Parallel || c.Request.ContentLength < 0 {
+			res, err := uploadService.UploadFileParallel(c)
+			if err != nil {
+				c.AbortWithError(err.Code, err.Error)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+			return
+		}
+
 		res, err := uploadService.UploadFile(c)
 
 		if err != nil {
@@ -13,6 +13,7 @@ func addUserRoutes(rg *gin.RouterGroup) {
 	r := rg.Group("/users")
 	r.Use(Authmiddleware)
 	userService := services.UserService{Db: database.DB}
+	mfaService := services.MFAService{Db: database.DB}
 
 	r.GET("/profile", func(c *gin.Context) {
 		if c.Query("photo") != "" {
@@ -20,6 +21,10 @@ func addUserRoutes(rg *gin.RouterGroup) {
 		}
 	})
 
+	r.GET("/events", func(c *gin.Context) {
+		userService.Events(c)
+	})
+
 	r.GET("/stats", func(c *gin.Context) {
 		res, err := userService.Stats(c)
 
@@ -85,6 +90,26 @@ func addUserRoutes(rg *gin.RouterGroup) {
 		c.JSON(http.StatusOK, res)
 	})
 
+	r.GET("/bots/health", func(c *gin.Context) {
+		res, err := userService.BotsHealth(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/bots/:botID/enable", func(c *gin.Context) {
+		res, err := userService.EnableBot(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
 	r.GET("/bots/revoke", func(c *gin.Context) {
 
 		res, err := userService.RevokeBotSession(c)
@@ -96,4 +121,54 @@ func addUserRoutes(rg *gin.RouterGroup) {
 
 		c.JSON(http.StatusOK, res)
 	})
+
+	r.GET("/mfa", func(c *gin.Context) {
+		res, err := mfaService.Status(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/mfa/setup", func(c *gin.Context) {
+		res, err := mfaService.Setup(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/mfa/enable", func(c *gin.Context) {
+		res, err := mfaService.Enable(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/mfa/disable", func(c *gin.Context) {
+		res, err := mfaService.Disable(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	r.POST("/mfa/recovery-codes", func(c *gin.Context) {
+		res, err := mfaService.RegenerateRecoveryCodes(c)
+
+		if err != nil {
+			c.AbortWithError(err.Code, err.Error)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
 }
@@ -0,0 +1,62 @@
+package schemas
+
+import "time"
+
+type AdminUserOut struct {
+	UserID     int64     `json:"userId"`
+	Name       string    `json:"name"`
+	UserName   string    `json:"userName"`
+	IsPremium  bool      `json:"isPremium"`
+	Disabled   bool      `json:"disabled"`
+	QuotaBytes *int64    `json:"quotaBytes"`
+	QuotaFiles *int64    `json:"quotaFiles"`
+	TotalSize  int64     `json:"totalSize"`
+	TotalFiles int64     `json:"totalFiles"`
+	Sessions   int64     `json:"sessions"`
+	Bots       int64     `json:"bots"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type AdminBotOut struct {
+	BotID          int64   `json:"botId"`
+	BotUserName    string  `json:"botUserName"`
+	ChannelID      int64   `json:"channelId"`
+	DisabledReason *string `json:"disabledReason,omitempty"`
+}
+
+type AdminUserUpdate struct {
+	Disabled   *bool  `json:"disabled"`
+	QuotaBytes *int64 `json:"quotaBytes"`
+	QuotaFiles *int64 `json:"quotaFiles"`
+}
+
+type AccessIn struct {
+	Role string `json:"role"`
+}
+
+type AccessOut struct {
+	UserID    int64     `json:"userId"`
+	Role      string    `json:"role"`
+	CreatedBy *int64    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type InvitationIn struct {
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type InvitationOut struct {
+	ID        string     `json:"id"`
+	Role      string     `json:"role"`
+	CreatedBy int64      `json:"createdBy"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	UsedBy    *int64     `json:"usedBy,omitempty"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type InvitationCreated struct {
+	InvitationOut
+	Code string `json:"code"`
+}
@@ -43,6 +43,7 @@ type FileIn struct {
 	Status    string        `json:"status,omitempty"`
 	UserID    int64         `json:"userId"`
 	ParentID  string        `json:"parentId"`
+	Conflict  string        `json:"conflict,omitempty"`
 }
 
 type FileOut struct {
@@ -55,6 +56,8 @@ type FileOut struct {
 	Starred   *bool     `json:"starred"`
 	ParentID  string    `json:"parentId,omitempty" mapstructure:"parent_id"`
 	UpdatedAt time.Time `json:"updatedAt,omitempty" mapstructure:"updated_at"`
+	Version   int       `json:"version"`
+	Outcome   string    `json:"outcome,omitempty" gorm:"-"`
 }
 
 type FileResponse struct {
@@ -69,13 +72,29 @@ type FileOutFull struct {
 }
 
 type FileOperation struct {
-	Files       []string `json:"files"`
-	Destination string   `json:"destination,omitempty"`
+	Files       []string       `json:"files"`
+	Destination string         `json:"destination,omitempty"`
+	Versions    map[string]int `json:"versions,omitempty"`
+	Conflict    string         `json:"conflict,omitempty"`
+}
+
+type FileOperationItem struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+type FileOperationResult struct {
+	Status  bool                `json:"status"`
+	Message string              `json:"message,omitempty"`
+	Items   []FileOperationItem `json:"items"`
 }
 
 type DirMove struct {
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	Conflict    string `json:"conflict,omitempty"`
 }
 
 type MkDir struct {
@@ -83,7 +102,31 @@ type MkDir struct {
 }
 
 type Copy struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Destination string `json:"destination"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Files       []string `json:"files,omitempty"`
+	Destination string   `json:"destination"`
+	Conflict    string   `json:"conflict,omitempty"`
+}
+
+type CopyFailure struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+type CopyJobOut struct {
+	ID           string        `json:"id"`
+	Items        []string      `json:"items"`
+	Destination  string        `json:"destination"`
+	Conflict     string        `json:"conflict"`
+	Status       string        `json:"status"`
+	TotalFiles   int           `json:"totalFiles"`
+	CopiedFiles  int           `json:"copiedFiles"`
+	SkippedFiles int           `json:"skippedFiles"`
+	FailedFiles  int           `json:"failedFiles"`
+	Failures     []CopyFailure `json:"failures,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
 }
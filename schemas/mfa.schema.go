@@ -0,0 +1,22 @@
+package schemas
+
+import "time"
+
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	RecoveryCodesLeft int        `json:"recoveryCodesLeft"`
+	EnabledAt         *time.Time `json:"enabledAt,omitempty"`
+}
+
+type MFASetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeIn struct {
+	Code string `json:"code"`
+}
+
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,26 @@
+package schemas
+
+import "time"
+
+type APITokenIn struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Path      string     `json:"path,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APITokenOut struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Path       string     `json:"path,omitempty"`
+	Revoked    bool       `json:"revoked"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type APITokenCreated struct {
+	APITokenOut
+	Token string `json:"token"`
+}
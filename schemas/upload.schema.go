@@ -1,23 +1,42 @@
 package schemas
 
+import "time"
+
 type UploadQuery struct {
 	Filename   string `form:"fileName"`
 	PartNo     int    `form:"partNo,omitempty"`
 	TotalParts int    `form:"totalparts"`
 	ChannelID  int64  `form:"channelId"`
+	Parallel   bool   `form:"parallel"`
+	SplitSize  int64  `form:"splitSize"`
+	Threads    int    `form:"threads"`
+	PartSize   int    `form:"partSize"`
+	Async      bool   `form:"async"`
 }
 
 type UploadPartOut struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	PartId    int    `json:"partId"`
-	PartNo    int    `json:"partNo"`
-	ChannelID int64  `json:"channelId"`
-	Size      int64  `json:"size"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	PartId    int           `json:"partId"`
+	PartNo    int           `json:"partNo"`
+	ChannelID int64         `json:"channelId"`
+	Size      int64         `json:"size"`
+	MimeType  *string       `json:"mimeType,omitempty"`
+	Tuning    *UploadTuning `json:"tuning,omitempty" gorm:"-"`
+}
+
+type UploadTuning struct {
+	Threads      int   `json:"threads"`
+	PartSize     int   `json:"partSize"`
+	Parts        int   `json:"parts"`
+	SlowParts    int   `json:"slowParts"`
+	FloodWaits   int   `json:"floodWaits"`
+	AvgLatencyMs int64 `json:"avgLatencyMs"`
 }
 
 type UploadOut struct {
 	Parts []UploadPartOut `json:"parts"`
+	Size  int64           `json:"size,omitempty"`
 }
 
 type UploadPart struct {
@@ -28,3 +47,34 @@ type UploadPart struct {
 	ChannelID int64  `json:"channelId"`
 	Size      int64  `json:"size"`
 }
+
+type UploadJobOut struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	PartNo        int       `json:"partNo"`
+	TotalParts    int       `json:"totalParts"`
+	Size          int64     `json:"size"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	UploadedBytes int64     `json:"uploadedBytes"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type UploadStatusOut struct {
+	UploadId      string         `json:"uploadId"`
+	Status        string         `json:"status"`
+	Size          int64          `json:"size"`
+	UploadedBytes int64          `json:"uploadedBytes"`
+	Progress      float64        `json:"progress"`
+	Jobs          []UploadJobOut `json:"jobs"`
+}
+
+type UploadComplete struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Path     string `json:"path"`
+	ParentID string `json:"parentId"`
+	Conflict string `json:"conflict,omitempty"`
+}
@@ -1,13 +1,56 @@
 package schemas
 
+import "time"
+
 type AccountStats struct {
-	TotalSize  int64  `json:"totalSize"`
-	TotalFiles int64  `json:"totalFiles"`
-	ChId       int64  `json:"channelId,omitempty"`
-	ChName     string `json:"channelName,omitempty"`
+	TotalSize      int64  `json:"totalSize"`
+	TotalFiles     int64  `json:"totalFiles"`
+	ChId           int64  `json:"channelId,omitempty"`
+	ChName         string `json:"channelName,omitempty"`
+	QuotaBytes     *int64 `json:"quotaBytes,omitempty" gorm:"-"`
+	QuotaFiles     *int64 `json:"quotaFiles,omitempty" gorm:"-"`
+	RemainingBytes *int64 `json:"remainingBytes,omitempty" gorm:"-"`
+	RemainingFiles *int64 `json:"remainingFiles,omitempty" gorm:"-"`
+	MaxFileSize    *int64 `json:"maxFileSize,omitempty" gorm:"-"`
 }
 
 type Channel struct {
 	ChannelID   int64  `json:"channelId"`
 	ChannelName string `json:"channelName"`
 }
+
+type SessionOut struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Current    bool       `json:"current"`
+}
+
+type SessionExportIn struct {
+	Format string `json:"format"`
+	Otp    string `json:"otp,omitempty"`
+}
+
+type SessionExport struct {
+	Format  string `json:"format"`
+	Session string `json:"session"`
+}
+
+type BotHealthOut struct {
+	BotID          int64      `json:"botId"`
+	BotUserName    string     `json:"botUserName"`
+	State          string     `json:"state"`
+	InFlight       int        `json:"inFlight"`
+	Errors         int        `json:"errors"`
+	Requests       int64      `json:"requests"`
+	FloodWaitUntil *time.Time `json:"floodWaitUntil,omitempty"`
+	CooldownUntil  *time.Time `json:"cooldownUntil,omitempty"`
+	DisabledReason string     `json:"disabledReason,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastErrorAt    *time.Time `json:"lastErrorAt,omitempty"`
+	AvgLatencyMs   int64      `json:"avgLatencyMs"`
+	BytesPerSecond int64      `json:"bytesPerSecond"`
+}
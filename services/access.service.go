@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/mapper"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/gin-gonic/gin"
+	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotAllowed = errors.New("user not allowed")
+
+type AccessService struct {
+	Db *gorm.DB
+}
+
+func validRole(role string) bool {
+	return role == types.RoleAdmin || role == types.RoleUser
+}
+
+// GetUserRole returns the role granted in the access table, admins from
+// ADMIN_USERS always get the admin role.
+func GetUserRole(userID int64) string {
+	if funk.ContainsInt64(utils.GetConfig().AdminUsers, userID) {
+		return types.RoleAdmin
+	}
+
+	var role string
+
+	key := fmt.Sprintf("users:role:%d", userID)
+
+	if err := cache.GetCache().Get(key, &role); err == nil {
+		return role
+	}
+
+	database.DB.Model(&models.AccessControl{}).Select("role").Where("user_id = ?", userID).Scan(&role)
+
+	cache.GetCache().Set(key, role, 60)
+
+	return role
+}
+
+func grantAccess(tx *gorm.DB, userID int64, role string, createdBy *int64) error {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&models.AccessControl{UserID: userID, Role: role, CreatedBy: createdBy}).Error; err != nil {
+		return err
+	}
+	cache.GetCache().Delete(fmt.Sprintf("users:role:%d", userID))
+	return nil
+}
+
+// checkUserIsAllowed decides whether a Telegram user may log in. Users in the
+// access table are always allowed. ALLOWED_USERS and ADMIN_USERS act as a
+// bootstrap: admins are always allowed and allowed usernames are copied into
+// the access table on first login. An unused invitation code pre-authorizes a
+// new user. Only an instance without access entries, invitations,
+// ALLOWED_USERS and ADMIN_USERS stays open as before.
+func checkUserIsAllowed(userID int64, userName, inviteCode string) error {
+	db := database.DB
+	config := utils.GetConfig()
+
+	if GetUserRole(userID) != "" {
+		return nil
+	}
+
+	if userName != "" && funk.ContainsString(config.AllowedUsers, userName) {
+		return grantAccess(db, userID, types.RoleUser, nil)
+	}
+
+	if inviteCode != "" {
+		return redeemInvitation(db, userID, inviteCode)
+	}
+
+	if len(config.AllowedUsers) > 0 || len(config.AdminUsers) > 0 {
+		return ErrNotAllowed
+	}
+
+	var entries, invitations int64
+
+	if err := db.Model(&models.AccessControl{}).Count(&entries).Error; err != nil {
+		return err
+	}
+
+	if err := db.Model(&models.Invitation{}).Count(&invitations).Error; err != nil {
+		return err
+	}
+
+	if entries == 0 && invitations == 0 {
+		return nil
+	}
+
+	return ErrNotAllowed
+}
+
+func redeemInvitation(db *gorm.DB, userID int64, code string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var invitations []models.Invitation
+
+		now := time.Now().UTC()
+
+		if err := tx.Model(&invitations).Clauses(clause.Returning{}).
+			Where("code_hash = ?", HashAPIToken(code)).Where("used_by is null").
+			Where("expires_at is null or expires_at > ?", now).
+			Updates(map[string]interface{}{"used_by": userID, "used_at": now}).Error; err != nil {
+			return err
+		}
+
+		if len(invitations) == 0 {
+			return ErrNotAllowed
+		}
+
+		return grantAccess(tx, userID, invitations[0].Role, &invitations[0].CreatedBy)
+	})
+}
+
+func (as *AccessService) ListAccess(c *gin.Context) ([]schemas.AccessOut, *types.AppError) {
+	var entries []models.AccessControl
+
+	if err := as.Db.Model(&models.AccessControl{}).Order("created_at").Find(&entries).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch access list"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.AccessOut{}
+
+	for _, entry := range entries {
+		res = append(res, *mapper.MapAccessSchema(&entry))
+	}
+
+	return res, nil
+}
+
+func (as *AccessService) UpdateAccess(c *gin.Context) (*schemas.Message, *types.AppError) {
+	adminId, _ := getUserAuth(c)
+
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var payload schemas.AccessIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil || !validRole(payload.Role) {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	if err := grantAccess(as.Db, userId, payload.Role, &adminId); err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to update access"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.Message{Status: true, Message: "access updated"}, nil
+}
+
+func (as *AccessService) RemoveAccess(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if funk.ContainsInt64(utils.GetConfig().AdminUsers, userId) {
+		return nil, &types.AppError{Error: errors.New("admins from ADMIN_USERS cannot be removed"), Code: http.StatusBadRequest}
+	}
+
+	if err := as.Db.Where("user_id = ?", userId).Delete(&models.AccessControl{}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to remove access"), Code: http.StatusInternalServerError}
+	}
+
+	cache.GetCache().Delete(fmt.Sprintf("users:role:%d", userId))
+
+	adminService := AdminService{Db: as.Db}
+
+	if err := adminService.logoutUser(userId); err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to logout user"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.Message{Status: true, Message: "access removed"}, nil
+}
+
+func (as *AccessService) CreateInvitation(c *gin.Context) (*schemas.InvitationCreated, *types.AppError) {
+	adminId, _ := getUserAuth(c)
+
+	payload := schemas.InvitationIn{Role: types.RoleUser}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || !validRole(payload.Role) {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	buf := make([]byte, 16)
+
+	if _, err := rand.Read(buf); err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to generate invitation"), Code: http.StatusInternalServerError}
+	}
+
+	code := hex.EncodeToString(buf)
+
+	invitation := &models.Invitation{CodeHash: HashAPIToken(code), Role: payload.Role, CreatedBy: adminId,
+		ExpiresAt: payload.ExpiresAt}
+
+	if err := as.Db.Create(invitation).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create invitation"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.InvitationCreated{InvitationOut: *mapper.MapInvitationSchema(invitation), Code: code}, nil
+}
+
+func (as *AccessService) ListInvitations(c *gin.Context) ([]schemas.InvitationOut, *types.AppError) {
+	var invitations []models.Invitation
+
+	if err := as.Db.Model(&models.Invitation{}).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch invitations"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.InvitationOut{}
+
+	for _, invitation := range invitations {
+		res = append(res, *mapper.MapInvitationSchema(&invitation))
+	}
+
+	return res, nil
+}
+
+func (as *AccessService) DeleteInvitation(c *gin.Context) (*schemas.Message, *types.AppError) {
+	res := as.Db.Where("id = ?", c.Param("id")).Delete(&models.Invitation{})
+
+	if res.Error != nil {
+		return nil, &types.AppError{Error: errors.New("failed to delete invitation"), Code: http.StatusInternalServerError}
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errors.New("invitation not found"), Code: http.StatusNotFound}
+	}
+
+	return &schemas.Message{Status: true, Message: "invitation deleted"}, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/mapper"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AdminService struct {
+	Db *gorm.DB
+}
+
+func IsAdmin(userID int64) bool {
+	return GetUserRole(userID) == types.RoleAdmin
+}
+
+func IsUserDisabled(userID int64) bool {
+	var disabled bool
+
+	key := fmt.Sprintf("users:disabled:%d", userID)
+
+	if err := cache.GetCache().Get(key, &disabled); err == nil {
+		return disabled
+	}
+
+	database.DB.Model(&models.User{}).Select("disabled").Where("user_id = ?", userID).Scan(&disabled)
+
+	cache.GetCache().Set(key, disabled, 60)
+
+	return disabled
+}
+
+func adminTargetUser(c *gin.Context) (int64, *types.AppError) {
+	userId, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		return 0, &types.AppError{Error: errors.New("invalid user id"), Code: http.StatusBadRequest}
+	}
+	return userId, nil
+}
+
+func (as *AdminService) ListUsers(c *gin.Context) ([]schemas.AdminUserOut, *types.AppError) {
+	res := []schemas.AdminUserOut{}
+
+	if err := as.Db.Raw(`select u.user_id, u.name, u.user_name, u.is_premium, u.disabled, u.created_at,
+	u.quota_bytes, u.quota_files,
+	coalesce(f.total_size, 0) as total_size, coalesce(f.total_files, 0) as total_files,
+	(select count(*) from teldrive.sessions s where s.user_id = u.user_id and s.expires_at > ?) as sessions,
+	(select count(*) from teldrive.bots b where b.user_id = u.user_id) as bots
+	from teldrive.users u left join (select user_id, sum(size) as total_size, count(*) as total_files
+	from teldrive.files where type = 'file' and status = 'active' group by user_id) f on f.user_id = u.user_id
+	order by u.created_at`, time.Now().UTC()).Scan(&res).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch users"), Code: http.StatusInternalServerError}
+	}
+
+	return res, nil
+}
+
+func (as *AdminService) ListUserSessions(c *gin.Context) ([]schemas.SessionOut, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var sessions []models.Session
+
+	if err := as.Db.Model(&models.Session{}).Where("user_id = ?", userId).
+		Where("expires_at > ?", time.Now().UTC()).Order("last_seen_at DESC NULLS LAST").
+		Find(&sessions).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch sessions"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.SessionOut{}
+
+	for _, session := range sessions {
+		res = append(res, *mapper.MapSessionSchema(&session))
+	}
+
+	return res, nil
+}
+
+func (as *AdminService) ListUserBots(c *gin.Context) ([]schemas.AdminBotOut, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	res := []schemas.AdminBotOut{}
+
+	if err := as.Db.Model(&models.Bot{}).Where("user_id = ?", userId).
+		Order("channel_id").Find(&res).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch bots"), Code: http.StatusInternalServerError}
+	}
+
+	return res, nil
+}
+
+func (as *AdminService) UpdateUser(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var payload schemas.AdminUserUpdate
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	updates := map[string]interface{}{}
+
+	if payload.Disabled != nil {
+		if *payload.Disabled && IsAdmin(userId) {
+			return nil, &types.AppError{Error: errors.New("admins cannot be disabled"), Code: http.StatusBadRequest}
+		}
+		updates["disabled"] = *payload.Disabled
+	}
+
+	// a negative quota resets the user to the configured default
+	for column, value := range map[string]*int64{"quota_bytes": payload.QuotaBytes, "quota_files": payload.QuotaFiles} {
+		if value == nil {
+			continue
+		}
+		if *value < 0 {
+			updates[column] = nil
+		} else {
+			updates[column] = *value
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil, &types.AppError{Error: errors.New("nothing to update"), Code: http.StatusBadRequest}
+	}
+
+	res := as.Db.Model(&models.User{}).Where("user_id = ?", userId).Updates(updates)
+
+	if res.Error != nil {
+		return nil, &types.AppError{Error: errors.New("failed to update user"), Code: http.StatusInternalServerError}
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errors.New("user not found"), Code: http.StatusNotFound}
+	}
+
+	cache.GetCache().Delete(fmt.Sprintf("users:quota:%d", userId))
+
+	if payload.Disabled == nil {
+		return &schemas.Message{Status: true, Message: "user updated"}, nil
+	}
+
+	cache.GetCache().Set(fmt.Sprintf("users:disabled:%d", userId), *payload.Disabled, 60)
+
+	if *payload.Disabled {
+		if err := as.logoutUser(userId); err != nil {
+			return nil, &types.AppError{Error: errors.New("failed to logout user"), Code: http.StatusInternalServerError}
+		}
+		return &schemas.Message{Status: true, Message: "user disabled"}, nil
+	}
+
+	return &schemas.Message{Status: true, Message: "user enabled"}, nil
+}
+
+func (as *AdminService) LogoutUser(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := as.logoutUser(userId); err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to logout user"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.Message{Status: true, Message: "user logged out"}, nil
+}
+
+// ResetUserMFA removes the second factor of a user who lost both the
+// authenticator and the recovery codes.
+func (as *AdminService) ResetUserMFA(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, appErr := adminTargetUser(c)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := as.Db.Where("user_id = ?", userId).Delete(&models.UserMFA{}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to reset two factor auth"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.Message{Status: true, Message: "two factor auth reset"}, nil
+}
+
+func (as *AdminService) logoutUser(userId int64) error {
+	var sessions []models.Session
+
+	if err := as.Db.Clauses(clause.Returning{}).Where("user_id = ?", userId).Delete(&sessions).Error; err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		evictSession(&session)
+	}
+	return nil
+}
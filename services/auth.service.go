@@ -1,27 +1,28 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
-	"encoding/base64"
-	"encoding/binary"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/big"
-	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/divyam234/teldrive/mapper"
 	"github.com/divyam234/teldrive/models"
 	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/types"
 	"github.com/divyam234/teldrive/utils"
 	"github.com/divyam234/teldrive/utils/auth"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/secret"
 	"github.com/divyam234/teldrive/utils/tgc"
+	"github.com/divyam234/teldrive/utils/throttle"
 	"github.com/gin-gonic/gin"
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/gorilla/websocket"
@@ -31,6 +32,7 @@ import (
 	"github.com/gotd/td/tg"
 	"github.com/gotd/td/tgerr"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthService struct {
@@ -50,45 +52,8 @@ type SocketMessage struct {
 	PhoneCodeHash string `json:"phoneCodeHash,omitempty"`
 	PhoneCode     string `json:"phoneCode,omitempty"`
 	Password      string `json:"password,omitempty"`
-}
-
-func IP4toInt(IPv4Address net.IP) int64 {
-	IPv4Int := big.NewInt(0)
-	IPv4Int.SetBytes(IPv4Address.To4())
-	return IPv4Int.Int64()
-}
-
-func Pack32BinaryIP4(ip4Address string) []byte {
-	ipv4Decimal := IP4toInt(net.ParseIP(ip4Address))
-
-	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.BigEndian, uint32(ipv4Decimal))
-	return buf.Bytes()
-}
-
-func generateTgSession(dcID int, authKey []byte, port int) string {
-
-	dcMaps := map[int]string{
-		1: "149.154.175.53",
-		2: "149.154.167.51",
-		3: "149.154.175.100",
-		4: "149.154.167.91",
-		5: "91.108.56.130",
-	}
-
-	dcIDByte := byte(dcID)
-	serverAddressBytes := Pack32BinaryIP4(dcMaps[dcID])
-	portByte := make([]byte, 2)
-	binary.BigEndian.PutUint16(portByte, uint16(port))
-
-	packet := make([]byte, 0)
-	packet = append(packet, dcIDByte)
-	packet = append(packet, serverAddressBytes...)
-	packet = append(packet, portByte...)
-	packet = append(packet, authKey...)
-
-	base64Encoded := base64.URLEncoding.EncodeToString(packet)
-	return "1" + base64Encoded
+	InviteCode    string `json:"inviteCode,omitempty"`
+	Otp           string `json:"otp,omitempty"`
 }
 
 func setCookie(c *gin.Context, key string, value string, age int) {
@@ -104,20 +69,32 @@ func setCookie(c *gin.Context, key string, value string, age int) {
 
 }
 
-func checkUserIsAllowed(userName string) bool {
-	config := utils.GetConfig()
-	found := false
-	if len(config.AllowedUsers) > 0 {
-		for _, user := range config.AllowedUsers {
-			if user == userName {
-				found = true
-				break
-			}
+// sessionUserID asks Telegram whom the session belongs to, the id sent by
+// the client is only a claim.
+func sessionUserID(ctx context.Context, sessionStr string) (int64, error) {
+	client, err := tgc.UserLogin(ctx, sessionStr)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var userId int64
+
+	err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
 		}
-	} else {
-		found = true
+		userId = self.ID
+		return nil
+	})
+
+	if err != nil {
+		tgc.UserClients.Remove(sessionStr)
+		return 0, err
 	}
-	return found
+
+	return userId, nil
 }
 
 func (as *AuthService) LogIn(c *gin.Context) (*schemas.Message, *types.AppError) {
@@ -126,16 +103,69 @@ func (as *AuthService) LogIn(c *gin.Context) (*schemas.Message, *types.AppError)
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
-	if !checkUserIsAllowed(session.UserName) {
-		return nil, &types.AppError{Error: errors.New("user not allowed"), Code: http.StatusUnauthorized}
+	info, normalized, err := tgc.NormalizeSession(session.Sesssion)
+
+	if err != nil {
+		return nil, &types.AppError{Error: tgc.ErrUnknownSessionFormat, Code: http.StatusBadRequest}
+	}
+
+	if info.UserID != 0 && info.UserID != session.UserID {
+		return nil, &types.AppError{Error: errors.New("session belongs to another user"), Code: http.StatusBadRequest}
+	}
+
+	session.Sesssion = normalized
+
+	userId, err := sessionUserID(c, session.Sesssion)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid session"), Code: http.StatusUnauthorized}
+	}
+
+	if userId != session.UserID {
+		return nil, &types.AppError{Error: errors.New("session belongs to another user"), Code: http.StatusBadRequest}
+	}
+
+	if err := checkUserIsAllowed(session.UserID, session.UserName, session.InviteCode); err != nil {
+		if errors.Is(err, ErrNotAllowed) {
+			return nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		return nil, &types.AppError{Error: errors.New("failed to check user access"), Code: http.StatusInternalServerError}
+	}
+
+	if session.Otp != "" && authLocked(c.ClientIP()) {
+		return nil, &types.AppError{Error: errors.New("too many failed attempts, try again later"), Code: http.StatusTooManyRequests}
+	}
+
+	if err := checkSecondFactor(session.UserID, session.Otp, session.MFATicket); err != nil {
+		if errors.Is(err, ErrSecondFactorRequired) {
+			return nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		if errors.Is(err, ErrInvalidSecondFactor) {
+			recordAuthFailure(c.ClientIP())
+			return nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		return nil, &types.AppError{Error: errors.New("failed to check second factor"), Code: http.StatusInternalServerError}
+	}
+
+	if session.Otp != "" {
+		clearAuthFailures(c.ClientIP())
 	}
 
 	now := time.Now().UTC()
 
+	sessionID, err := generateSessionID()
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	sessionExpires := now.Add(utils.GetConfig().SessionMaxLifetime)
+
 	jwtClaims := &types.JWTClaims{Claims: jwt.Claims{
+		ID:       sessionID,
 		Subject:  strconv.FormatInt(session.UserID, 10),
 		IssuedAt: jwt.NewNumericDate(now),
-		Expiry:   jwt.NewNumericDate(now.Add(time.Duration(as.SessionMaxAge) * time.Second)),
+		Expiry:   jwt.NewNumericDate(capExpiry(now.Add(time.Duration(as.SessionMaxAge)*time.Second), sessionExpires)),
 	}, TgSession: session.Sesssion,
 		Name:      session.Name,
 		UserName:  session.UserName,
@@ -167,6 +197,9 @@ func (as *AuthService) LogIn(c *gin.Context) (*schemas.Message, *types.AppError)
 		return nil, &types.AppError{Error: errors.New("failed to find user"),
 			Code: http.StatusInternalServerError}
 	}
+	if len(result) > 0 && result[0].Disabled {
+		return nil, &types.AppError{Error: errors.New("user disabled"), Code: http.StatusForbidden}
+	}
 	if len(result) == 0 {
 		if err := as.Db.Create(&user).Error; err != nil {
 			return nil, &types.AppError{Error: errors.New("failed to create or update user"),
@@ -194,7 +227,16 @@ func (as *AuthService) LogIn(c *gin.Context) (*schemas.Message, *types.AppError)
 
 	//create session
 
-	if err := as.Db.Create(&models.Session{UserId: session.UserID, Hash: hexToken, Session: session.Sesssion}).Error; err != nil {
+	sealedSession, err := secret.Encrypt(session.Sesssion)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to encrypt user session"),
+			Code: http.StatusInternalServerError}
+	}
+
+	if err := as.Db.Create(&models.Session{ID: sessionID, UserId: session.UserID, Hash: hexToken,
+		Session: sealedSession, UserAgent: c.Request.UserAgent(), IP: c.ClientIP(),
+		LastSeenAt: &now, ExpiresAt: &sessionExpires, Verified: true}).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to create  user session"),
 			Code: http.StatusInternalServerError}
 	}
@@ -216,9 +258,19 @@ func (as *AuthService) GetSession(c *gin.Context) *types.Session {
 		return nil
 	}
 
+	registered, err := GetSessionByID(jwePayload.ID)
+
+	if err != nil || registered.ExpiresAt == nil {
+		return nil
+	}
+
 	now := time.Now().UTC()
 
-	newExpires := now.Add(time.Duration(as.SessionMaxAge) * time.Second)
+	if registered.ExpiresAt.Before(now) {
+		return nil
+	}
+
+	newExpires := capExpiry(now.Add(time.Duration(as.SessionMaxAge)*time.Second), *registered.ExpiresAt)
 
 	session := &types.Session{Name: jwePayload.Name,
 		UserName: jwePayload.UserName,
@@ -234,27 +286,178 @@ func (as *AuthService) GetSession(c *gin.Context) *types.Session {
 	if err != nil {
 		return nil
 	}
-	setCookie(c, as.SessionCookieName, jweToken, as.SessionMaxAge)
+	setCookie(c, as.SessionCookieName, jweToken, int(newExpires.Sub(now).Seconds()))
 	return session
 }
 
 func (as *AuthService) Logout(c *gin.Context) (*schemas.Message, *types.AppError) {
+	if _, ok := c.Get("apiToken"); ok {
+		return nil, &types.AppError{Error: errors.New("api tokens cannot logout sessions"), Code: http.StatusForbidden}
+	}
 	val, _ := c.Get("jwtUser")
 	jwtUser := val.(*types.JWTClaims)
-	client, _ := tgc.UserLogin(c, jwtUser.TgSession)
+	if client, err := tgc.UserLogin(c, jwtUser.TgSession); err == nil {
+		tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+			_, err := client.API().AuthLogOut(c)
+			return err
+		})
+	}
 
-	tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
-		_, err := client.API().AuthLogOut(c)
-		return err
-	})
+	tgc.UserClients.Remove(jwtUser.TgSession)
 
 	setCookie(c, as.SessionCookieName, "", -1)
-	as.Db.Where("session = ?", jwtUser.TgSession).Delete(&models.Session{})
+
+	var sessions []models.Session
+	as.Db.Clauses(clause.Returning{}).Where("hash = ?", jwtUser.Hash).Delete(&sessions)
+	for _, session := range sessions {
+		evictSession(&session)
+	}
 	return &schemas.Message{Status: true, Message: "logout success"}, nil
 }
 
+func (as *AuthService) ListSessions(c *gin.Context) ([]schemas.SessionOut, *types.AppError) {
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+	userId, _ := getUserAuth(c)
+
+	var sessions []models.Session
+
+	if err := as.Db.Model(&models.Session{}).Where("user_id = ?", userId).
+		Where("expires_at > ?", time.Now().UTC()).Order("last_seen_at DESC NULLS LAST").
+		Find(&sessions).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch sessions"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.SessionOut{}
+
+	for _, session := range sessions {
+		out := mapper.MapSessionSchema(&session)
+		out.Current = session.ID == jwtUser.ID
+		res = append(res, *out)
+	}
+
+	return res, nil
+}
+
+func (as *AuthService) RevokeSession(c *gin.Context) (*schemas.Message, *types.AppError) {
+	if _, ok := c.Get("apiToken"); ok {
+		return nil, &types.AppError{Error: errors.New("api tokens cannot revoke sessions"), Code: http.StatusForbidden}
+	}
+
+	userId, _ := getUserAuth(c)
+
+	var sessions []models.Session
+
+	if err := as.Db.Clauses(clause.Returning{}).Where("id = ?", c.Param("id")).
+		Where("user_id = ?", userId).Delete(&sessions).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to revoke session"), Code: http.StatusInternalServerError}
+	}
+
+	if len(sessions) == 0 {
+		return nil, &types.AppError{Error: errors.New("session not found"), Code: http.StatusNotFound}
+	}
+
+	evictSession(&sessions[0])
+
+	return &schemas.Message{Status: true, Message: "session revoked"}, nil
+}
+
+// ExportSession returns the Telegram session of the current login in the
+// format of another client library.
+func (as *AuthService) ExportSession(c *gin.Context) (*schemas.SessionExport, *types.AppError) {
+	if _, ok := c.Get("apiToken"); ok {
+		return nil, &types.AppError{Error: errors.New("api tokens cannot export sessions"), Code: http.StatusForbidden}
+	}
+
+	var payload schemas.SessionExportIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	if payload.Format == "" {
+		payload.Format = tgc.FormatTelethon
+	}
+
+	if authLocked(c.ClientIP()) {
+		return nil, &types.AppError{Error: errors.New("too many failed attempts, try again later"), Code: http.StatusTooManyRequests}
+	}
+
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+	userId, tgSession := getUserAuth(c)
+
+	if err := checkSecondFactor(userId, payload.Otp, ""); err != nil {
+		if errors.Is(err, ErrSecondFactorRequired) {
+			return nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		if errors.Is(err, ErrInvalidSecondFactor) {
+			recordAuthFailure(c.ClientIP())
+			return nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		return nil, &types.AppError{Error: errors.New("failed to check second factor"), Code: http.StatusInternalServerError}
+	}
+
+	tgSession, err := secret.Decrypt(tgSession)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to decrypt session"), Code: http.StatusInternalServerError}
+	}
+
+	info, err := tgc.ParseSession(tgSession)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	exported, err := tgc.EncodeSession(info.Data, payload.Format, utils.GetConfig().AppId, userId, jwtUser.Bot)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	return &schemas.SessionExport{Format: payload.Format, Session: exported}, nil
+}
+
+func generateSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// capExpiry keeps sliding refreshes within the absolute session lifetime.
+func capExpiry(expiry, limit time.Time) time.Time {
+	if expiry.After(limit) {
+		return limit
+	}
+	return expiry
+}
+
+// authLocked reports whether the ip has exhausted its failed sign in and 2FA
+// attempts. Every failure extends the lockout window.
+func authLocked(ip string) bool {
+	var failures int
+	if err := cache.GetCache().Get(fmt.Sprintf("authfail:%s", ip), &failures); err != nil {
+		return false
+	}
+	return failures >= utils.GetConfig().AuthMaxFailures
+}
+
+func recordAuthFailure(ip string) {
+	var failures int
+	key := fmt.Sprintf("authfail:%s", ip)
+	cache.GetCache().Get(key, &failures)
+	cache.GetCache().Set(key, failures+1, int(utils.GetConfig().AuthLockout.Seconds()))
+}
+
+func clearAuthFailures(ip string) {
+	cache.GetCache().Delete(fmt.Sprintf("authfail:%s", ip))
+}
+
 func prepareSession(user *tg.User, data *session.Data) *types.TgSession {
-	sessionString := generateTgSession(data.DC, data.AuthKey, 443)
+	sessionString, _ := tgc.EncodeSession(&session.Data{DC: data.DC, AuthKey: data.AuthKey}, tgc.FormatTelethon, 0, 0, false)
 	session := &types.TgSession{
 		Sesssion:  sessionString,
 		UserID:    user.ID,
@@ -268,9 +471,7 @@ func prepareSession(user *tg.User, data *session.Data) *types.TgSession {
 
 func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin: utils.CheckOrigin,
 	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -278,11 +479,40 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 	}
 	defer conn.Close()
 
+	ip := c.ClientIP()
+
 	dispatcher := tg.NewUpdateDispatcher()
 	loggedIn := qrlogin.OnLoginToken(dispatcher)
 	sessionStorage := &session.StorageMemory{}
 	tgClient := tgc.NoLogin(c, dispatcher, sessionStorage)
 
+	var (
+		mu      sync.Mutex
+		pending *types.TgSession
+	)
+
+	// completeLogin hands the Telegram session to the client. When the user has
+	// two factor auth enabled it is held back until a valid code is sent.
+	completeLogin := func(user *tg.User) {
+		res, _ := sessionStorage.LoadSession(c)
+		sessionData := &SessionData{}
+		json.Unmarshal(res, sessionData)
+		session := prepareSession(user, &sessionData.Data)
+		enabled, err := mfaEnabled(user.ID)
+		if err != nil {
+			conn.WriteJSON(map[string]interface{}{"type": "error", "message": "failed to check second factor"})
+			return
+		}
+		if enabled {
+			mu.Lock()
+			pending = session
+			mu.Unlock()
+			conn.WriteJSON(map[string]interface{}{"type": "auth", "message": "OTP required"})
+			return
+		}
+		conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
+	}
+
 	err = tgClient.Run(c, func(ctx context.Context) error {
 		for {
 			message := &SocketMessage{}
@@ -291,6 +521,43 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 			if err != nil {
 				return err
 			}
+			if limiter := throttle.Group("authws"); limiter != nil {
+				if ok, _ := limiter.Allow("authws:" + ip); !ok {
+					conn.WriteJSON(map[string]interface{}{"type": "error", "message": "too many requests"})
+					continue
+				}
+			}
+			if (message.Message == "signin" || message.AuthType == "2fa" || message.AuthType == "otp") && authLocked(ip) {
+				conn.WriteJSON(map[string]interface{}{"type": "error", "message": "too many failed attempts, try again later"})
+				continue
+			}
+			if message.AuthType == "otp" && message.Otp != "" {
+				mu.Lock()
+				session := pending
+				mu.Unlock()
+				if session == nil {
+					conn.WriteJSON(map[string]interface{}{"type": "error", "message": "no pending login"})
+					continue
+				}
+				err := checkSecondFactor(session.UserID, message.Otp, "")
+				if errors.Is(err, ErrInvalidSecondFactor) {
+					recordAuthFailure(ip)
+					conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error()})
+					continue
+				}
+				if err == nil {
+					session.MFATicket, err = issueMFATicket(session.UserID)
+				}
+				if err != nil {
+					conn.WriteJSON(map[string]interface{}{"type": "error", "message": "failed to check second factor"})
+					continue
+				}
+				clearAuthFailures(ip)
+				mu.Lock()
+				pending = nil
+				mu.Unlock()
+				conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
+			}
 			if message.AuthType == "qr" {
 				go func() {
 					authorization, err := tgClient.QR().Auth(c, loggedIn, func(ctx context.Context, token qrlogin.Token) error {
@@ -312,16 +579,12 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "auth failed"})
 						return
 					}
-					if !checkUserIsAllowed(user.Username) {
+					if checkUserIsAllowed(user.ID, user.Username, message.InviteCode) != nil {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
 					}
-					res, _ := sessionStorage.LoadSession(c)
-					sessionData := &SessionData{}
-					json.Unmarshal(res, sessionData)
-					session := prepareSession(user, &sessionData.Data)
-					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
+					completeLogin(user)
 				}()
 			}
 			if message.AuthType == "phone" && message.Message == "sendcode" {
@@ -340,29 +603,28 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 					auth, err := tgClient.Auth().SignIn(c, message.PhoneNo, message.PhoneCode, message.PhoneCodeHash)
 
 					if errors.Is(err, tgauth.ErrPasswordAuthNeeded) {
+						clearAuthFailures(ip)
 						conn.WriteJSON(map[string]interface{}{"type": "auth", "message": "2FA required"})
 						return
 					}
 
 					if err != nil {
+						recordAuthFailure(ip)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error()})
 						return
 					}
+					clearAuthFailures(ip)
 					user, ok := auth.User.AsNotEmpty()
 					if !ok {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "auth failed"})
 						return
 					}
-					if !checkUserIsAllowed(user.Username) {
+					if checkUserIsAllowed(user.ID, user.Username, message.InviteCode) != nil {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
 					}
-					res, _ := sessionStorage.LoadSession(c)
-					sessionData := &SessionData{}
-					json.Unmarshal(res, sessionData)
-					session := prepareSession(user, &sessionData.Data)
-					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
+					completeLogin(user)
 				}()
 			}
 
@@ -370,24 +632,22 @@ func (as *AuthService) HandleMultipleLogin(c *gin.Context) {
 				go func() {
 					auth, err := tgClient.Auth().Password(c, message.Password)
 					if err != nil {
+						recordAuthFailure(ip)
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": err.Error()})
 						return
 					}
+					clearAuthFailures(ip)
 					user, ok := auth.User.AsNotEmpty()
 					if !ok {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "auth failed"})
 						return
 					}
-					if !checkUserIsAllowed(user.Username) {
+					if checkUserIsAllowed(user.ID, user.Username, message.InviteCode) != nil {
 						conn.WriteJSON(map[string]interface{}{"type": "error", "message": "user not allowed"})
 						tgClient.API().AuthLogOut(c)
 						return
 					}
-					res, _ := sessionStorage.LoadSession(c)
-					sessionData := &SessionData{}
-					json.Unmarshal(res, sessionData)
-					session := prepareSession(user, &sessionData.Data)
-					conn.WriteJSON(map[string]interface{}{"type": "auth", "payload": session, "message": "success"})
+					completeLogin(user)
 				}()
 			}
 		}
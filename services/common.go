@@ -4,19 +4,24 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/divyam234/teldrive/database"
 	"github.com/divyam234/teldrive/models"
 	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/types"
 	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/secret"
 	"github.com/divyam234/teldrive/utils/tgc"
 	"github.com/gin-gonic/gin"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 	"github.com/pkg/errors"
 	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
 )
 
 func getChunk(ctx context.Context, tgClient *telegram.Client, location tg.InputFileLocationClass, offset int64, limit int64) ([]byte, error) {
@@ -243,10 +248,16 @@ func GetBotsToken(ctx context.Context, userID, channelId int64) ([]string, error
 	}
 
 	if err := database.DB.Model(&models.Bot{}).Where("user_id = ?", userID).
-		Where("channel_id = ?", channelId).Pluck("token", &bots).Error; err != nil {
+		Where("channel_id = ?", channelId).Where("disabled_reason IS NULL").Pluck("token", &bots).Error; err != nil {
 		return nil, err
 	}
 
+	for i, token := range bots {
+		if bots[i], err = secret.Decrypt(token); err != nil {
+			return nil, err
+		}
+	}
+
 	cache.GetCache().Set(key, &bots, 0)
 	return bots, nil
 
@@ -260,16 +271,167 @@ func GetSessionByHash(hash string) (*models.Session, error) {
 
 	err := cache.GetCache().Get(key, &session)
 
+	if err == nil {
+		if session.ExpiresAt == nil || session.ExpiresAt.Before(time.Now().UTC()) {
+			return nil, errors.New("session expired")
+		}
+		return &session, nil
+	}
+
+	if err := database.DB.Model(&models.Session{}).Where("hash = ?", hash).
+		Where("expires_at > ?", time.Now().UTC()).First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	cache.GetCache().Set(key, &session, 300)
+
+	return &session, nil
+
+}
+
+func GetAPITokenByHash(hash string) (*models.APIToken, error) {
+
+	var token models.APIToken
+
+	key := fmt.Sprintf("apitokens:%s", hash)
+
+	err := cache.GetCache().Get(key, &token)
+
+	if err == nil {
+		return &token, nil
+	}
+
+	if err := database.DB.Model(&models.APIToken{}).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+
+	cache.GetCache().Set(key, &token, 300)
+
+	return &token, nil
+}
+
+func GetLatestSession(userID int64) (*models.Session, error) {
+
+	var session models.Session
+
+	if err := database.DB.Model(&models.Session{}).Where("user_id = ?", userID).
+		Where("expires_at > ?", time.Now().UTC()).
+		Order("created_at DESC").First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func getTokenPath(c *gin.Context) string {
+	val, ok := c.Get("apiToken")
+	if !ok {
+		return ""
+	}
+	return val.(*models.APIToken).Path
+}
+
+func pathInScope(scope, path string) bool {
+	if scope == "" || scope == "/" {
+		return true
+	}
+	return path == scope || strings.HasPrefix(path, scope+"/")
+}
+
+func checkPathScope(c *gin.Context, path string) *types.AppError {
+	if !pathInScope(getTokenPath(c), path) {
+		return &types.AppError{Error: errors.New("path outside token scope"), Code: http.StatusForbidden}
+	}
+	return nil
+}
+
+// checkFileScope resolves the folder each file lives in and verifies it is
+// inside the subtree the api token is restricted to.
+func checkFileScope(c *gin.Context, db *gorm.DB, ids ...string) *types.AppError {
+	scope := getTokenPath(c)
+
+	if scope == "" || scope == "/" {
+		return nil
+	}
+
+	var paths []string
+
+	if err := db.Raw(`select case when f.type = 'folder' then f.path else p.path end
+	from teldrive.files f left join teldrive.files p on p.id = f.parent_id where f.id in ?`, ids).
+		Scan(&paths).Error; err != nil {
+		return &types.AppError{Error: errors.New("failed to check token scope"), Code: http.StatusInternalServerError}
+	}
+
+	if len(paths) != len(ids) {
+		return &types.AppError{Error: errors.New("file not found"), Code: http.StatusNotFound}
+	}
+
+	for _, path := range paths {
+		if !pathInScope(scope, path) {
+			return &types.AppError{Error: errors.New("path outside token scope"), Code: http.StatusForbidden}
+		}
+	}
+	return nil
+}
+
+// scopeFilesQuery limits a files query to the subtree of the api token.
+func scopeFilesQuery(c *gin.Context, query *gorm.DB) *gorm.DB {
+	scope := getTokenPath(c)
+
+	if scope == "" || scope == "/" {
+		return query
+	}
+
+	return query.Where("parent_id in (select id from teldrive.files where type = 'folder' and (path = ? or path like ?))",
+		scope, scope+"/%")
+}
+
+func GetSessionByID(id string) (*models.Session, error) {
+
+	var session models.Session
+
+	if id == "" {
+		return nil, errors.New("missing session id")
+	}
+
+	key := fmt.Sprintf("sessions:id:%s", id)
+
+	err := cache.GetCache().Get(key, &session)
+
 	if err == nil {
 		return &session, nil
 	}
 
-	if err := database.DB.Model(&models.Session{}).Where("hash = ?", hash).First(&session).Error; err != nil {
+	if err := database.DB.Model(&models.Session{}).Where("id = ?", id).First(&session).Error; err != nil {
 		return nil, err
 	}
 
-	cache.GetCache().Set(key, &session, 0)
+	cache.GetCache().Set(key, &session, 300)
 
 	return &session, nil
+}
+
+// TouchSession records the last activity of a session at most once a minute.
+func TouchSession(session *models.Session, ip, userAgent string) {
+	now := time.Now().UTC()
+
+	if session.LastSeenAt != nil && now.Sub(*session.LastSeenAt) < time.Minute {
+		return
+	}
+
+	session.LastSeenAt = &now
+	session.IP = ip
+	session.UserAgent = userAgent
+
+	if err := database.DB.Model(&models.Session{}).Where("id = ?", session.ID).
+		UpdateColumns(map[string]interface{}{"last_seen_at": now, "ip": ip, "user_agent": userAgent}).Error; err != nil {
+		return
+	}
+
+	cache.GetCache().Set(fmt.Sprintf("sessions:id:%s", session.ID), session, 300)
+}
 
+func evictSession(session *models.Session) {
+	cache.GetCache().Delete(fmt.Sprintf("sessions:id:%s", session.ID))
+	cache.GetCache().Delete(fmt.Sprintf("sessions:%s", session.Hash))
 }
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils/cache"
+	"gorm.io/gorm"
+)
+
+// Conflict policies for an item whose name is already taken at the target.
+const (
+	ConflictFail      = "fail"
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictKeepBoth  = "keep-both"
+	ConflictMerge     = "merge"
+)
+
+// Outcomes reported per item.
+const (
+	OutcomeDone        = "done"
+	OutcomeSkipped     = "skipped"
+	OutcomeOverwritten = "overwritten"
+	OutcomeRenamed     = "renamed"
+	OutcomeMerged      = "merged"
+	OutcomeFailed      = "failed"
+)
+
+// maxKeepBothSuffix bounds the search for a free "name (n)".
+const maxKeepBothSuffix = 1000
+
+var errFileExists = errors.New("file exists")
+
+func parseConflictPolicy(policy string) (string, *types.AppError) {
+	switch policy {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite, ConflictKeepBoth, ConflictMerge:
+		return policy, nil
+	}
+	return "", &types.AppError{Error: fmt.Errorf("unknown conflict policy %q", policy), Code: http.StatusBadRequest}
+}
+
+// conflictResolution is what to do with an item after checking its target.
+type conflictResolution struct {
+	Name     string
+	Outcome  string
+	Existing *models.File
+}
+
+// resolveConflict checks whether name is taken in parentId and applies the
+// policy. excludeId is the item itself, which doesn't conflict with itself.
+// Merge only applies when both items are folders, colliding files are kept
+// both. With overwrite the existing item is deleted, so it must run in the
+// transaction that places the new item.
+func resolveConflict(tx *gorm.DB, userId int64, parentId, name, itemType, policy, excludeId string) (*conflictResolution, *types.AppError) {
+	existing, err := findByName(tx, userId, parentId, name, excludeId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if existing == nil {
+		return &conflictResolution{Name: name}, nil
+	}
+
+	res := &conflictResolution{Name: name, Existing: existing}
+
+	if policy == ConflictMerge && (itemType != "folder" || existing.Type != "folder") {
+		policy = ConflictKeepBoth
+	}
+
+	switch policy {
+	case ConflictSkip:
+		res.Outcome = OutcomeSkipped
+	case ConflictMerge:
+		res.Outcome = OutcomeMerged
+	case ConflictOverwrite:
+		if err := tx.Exec("call teldrive.delete_files($1)", []string{existing.ID}).Error; err != nil {
+			return nil, &types.AppError{Error: errors.New("failed to delete existing file"), Code: http.StatusInternalServerError}
+		}
+		cache.GetCache().Delete(fmt.Sprintf("files:%s", existing.ID))
+		res.Outcome = OutcomeOverwritten
+	case ConflictKeepBoth:
+		res.Name, err = uniqueName(tx, userId, parentId, name, itemType)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusConflict}
+		}
+		res.Outcome = OutcomeRenamed
+	default:
+		return nil, &types.AppError{Error: errFileExists, Code: http.StatusConflict}
+	}
+
+	return res, nil
+}
+
+func findByName(tx *gorm.DB, userId int64, parentId, name, excludeId string) (*models.File, error) {
+	var files []models.File
+
+	query := tx.Where("user_id = ? AND parent_id = ? AND name = ? AND status = ?", userId, parentId, name, "active")
+
+	if excludeId != "" {
+		query = query.Where("id != ?", excludeId)
+	}
+
+	if err := query.Limit(1).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	return &files[0], nil
+}
+
+// uniqueName returns the first free "name (n)" in parentId, keeping the
+// extension of files at the end.
+func uniqueName(tx *gorm.DB, userId int64, parentId, name, itemType string) (string, error) {
+	base, ext := name, ""
+
+	if itemType != "folder" {
+		ext = filepath.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+	}
+
+	for n := 1; n <= maxKeepBothSuffix; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		existing, err := findByName(tx, userId, parentId, candidate, "")
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("no free name left")
+}
+
+func childPath(parentPath, name string) string {
+	if parentPath == "/" || parentPath == "" {
+		return "/" + name
+	}
+	return parentPath + "/" + name
+}
+
+// moveItem places item in the folder dest under name, folder paths below
+// it are rewritten.
+func moveItem(tx *gorm.DB, item *models.File, dest *models.File, name string) error {
+	if err := tx.Model(&models.File{}).Where("id = ?", item.ID).
+		Updates(map[string]interface{}{"parent_id": dest.ID, "name": name}).Error; err != nil {
+		return err
+	}
+
+	if item.Type == "folder" {
+		if err := tx.Exec("select from teldrive.update_folder(?, ?, ?)", item.ID, name, childPath(dest.Path, name)).Error; err != nil {
+			return err
+		}
+	}
+
+	cache.GetCache().Delete(fmt.Sprintf("files:%s", item.ID))
+
+	return nil
+}
+
+// mergeFolders moves the content of src into dest and removes src. Folders
+// present in both are merged as well, colliding files are kept both.
+func mergeFolders(tx *gorm.DB, userId int64, src *models.File, dest *models.File) error {
+	var children []models.File
+
+	if err := tx.Where("user_id = ? AND parent_id = ? AND status = ?", userId, src.ID, "active").
+		Find(&children).Error; err != nil {
+		return err
+	}
+
+	for i := range children {
+		child := &children[i]
+
+		res, appErr := resolveConflict(tx, userId, dest.ID, child.Name, child.Type, ConflictMerge, "")
+
+		if appErr != nil {
+			return appErr.Error
+		}
+
+		if res.Outcome == OutcomeMerged {
+			if err := mergeFolders(tx, userId, child, res.Existing); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := moveItem(tx, child, dest, res.Name); err != nil {
+			return err
+		}
+	}
+
+	// the emptied folder goes through the same path as any other delete
+	return tx.Exec("call teldrive.delete_files($1)", []string{src.ID}).Error
+}
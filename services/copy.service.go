@@ -0,0 +1,701 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/mapper"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/events"
+	"github.com/divyam234/teldrive/utils/tgc"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	copyRunning   = "running"
+	copyDone      = "done"
+	copyFailed    = "failed"
+	copyCancelled = "cancelled"
+)
+
+// copyBatchSize is the most messages Telegram forwards in one request.
+const copyBatchSize = 100
+
+// maxCopyFailures bounds the failures kept on a job, the count is exact.
+const maxCopyFailures = 100
+
+// copyReportInterval is how often progress is written while no batch is
+// forwarded.
+const copyReportInterval = 10 * time.Second
+
+// copyHeartbeatInterval is how often a running job touches its row, also
+// while a forward is blocked, so it isn't taken for interrupted.
+const copyHeartbeatInterval = time.Minute
+
+var (
+	copyCancels  sync.Map
+	copyWG       sync.WaitGroup
+	copyShutdown atomic.Bool
+)
+
+type copyTreeStats struct {
+	Files int
+	Size  int64
+}
+
+// copyTree counts the files below the given items.
+func copyTree(db *gorm.DB, userId int64, ids []string) (*copyTreeStats, error) {
+	var stats copyTreeStats
+
+	err := db.Raw(`WITH RECURSIVE tree AS (
+		SELECT id, type, size FROM teldrive.files WHERE id IN ? AND user_id = ? AND status = 'active'
+		UNION ALL
+		SELECT f.id, f.type, f.size FROM teldrive.files f JOIN tree t ON f.parent_id = t.id WHERE f.status = 'active'
+	)
+	SELECT count(*) FILTER (WHERE type = 'file') AS files,
+		coalesce(sum(size) FILTER (WHERE type = 'file'), 0) AS size FROM tree`, ids, userId).Scan(&stats).Error
+
+	return &stats, err
+}
+
+// startCopyJob copies folders and selections of several items in the
+// background and returns the job to follow its progress.
+func startCopyJob(db *gorm.DB, userId int64, session string, items []models.File, payload *schemas.Copy,
+	policy string) (*schemas.CopyJobOut, *types.AppError) {
+
+	ids := make([]string, 0, len(items))
+
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	stats, err := copyTree(db, userId, ids)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if err := checkQuota(userId, stats.Size, int64(stats.Files), false); err != nil {
+		return nil, err
+	}
+
+	job := &models.CopyJob{
+		UserId:      userId,
+		Items:       ids,
+		Destination: payload.Destination,
+		Conflict:    policy,
+		Status:      copyRunning,
+		TotalFiles:  stats.Files,
+		Failures:    models.CopyFailures{},
+	}
+
+	if len(items) == 1 && payload.Name != "" {
+		job.Name = &payload.Name
+	}
+
+	if err := db.Create(job).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create copy job"), Code: http.StatusInternalServerError}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	copyCancels.Store(job.ID, cancel)
+
+	copyWG.Add(1)
+
+	go func() {
+		defer copyWG.Done()
+		defer copyCancels.Delete(job.ID)
+		defer cancel()
+		runCopyJob(ctx, cancel, job, session, items)
+	}()
+
+	return mapper.MapCopyJobSchema(job), nil
+}
+
+func (fs *FileService) GetCopyJob(c *gin.Context) (*schemas.CopyJobOut, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	var job models.CopyJob
+
+	if err := fs.Db.Where("id = ?", c.Param("id")).Where("user_id = ?", userId).First(&job).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("copy job not found"), Code: http.StatusNotFound}
+	}
+
+	return mapper.MapCopyJobSchema(&job), nil
+}
+
+func (fs *FileService) ListCopyJobs(c *gin.Context) ([]schemas.CopyJobOut, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	var jobs []models.CopyJob
+
+	if err := fs.Db.Where("user_id = ?", userId).Order("created_at desc").Limit(50).Find(&jobs).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.CopyJobOut{}
+
+	for i := range jobs {
+		res = append(res, *mapper.MapCopyJobSchema(&jobs[i]))
+	}
+
+	return res, nil
+}
+
+// CancelCopyJob stops a running copy after the batch in flight. Files
+// copied so far are kept. The job may run on another instance, it notices
+// the status change with its next progress report.
+func (fs *FileService) CancelCopyJob(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	jobId := c.Param("id")
+
+	res := fs.Db.Model(&models.CopyJob{}).Where("id = ?", jobId).Where("user_id = ?", userId).
+		Where("status = ?", copyRunning).Updates(map[string]interface{}{"status": copyCancelled, "updated_at": time.Now().UTC()})
+
+	if res.Error != nil {
+		return nil, &types.AppError{Error: errors.New("failed to cancel copy job"), Code: http.StatusInternalServerError}
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errors.New("no running copy job found"), Code: http.StatusNotFound}
+	}
+
+	if cancel, ok := copyCancels.Load(jobId); ok {
+		cancel.(context.CancelFunc)()
+	}
+
+	return &schemas.Message{Status: true, Message: "copy job cancelled"}, nil
+}
+
+// StopCopyJobs cancels running copies on shutdown, they end as failed.
+func StopCopyJobs() {
+	copyShutdown.Store(true)
+	copyCancels.Range(func(_, cancel any) bool {
+		cancel.(context.CancelFunc)()
+		return true
+	})
+	copyWG.Wait()
+}
+
+type copyTask struct {
+	file *models.File
+	dest *models.File
+	name string
+}
+
+type copier struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	db          *gorm.DB
+	job         *models.CopyJob
+	client      *telegram.Client
+	channelUser string
+	channels    map[int64]*tg.InputChannel
+	batch       []copyTask
+	batchParts  int
+	lastReport  time.Time
+}
+
+func runCopyJob(ctx context.Context, cancel context.CancelFunc, job *models.CopyJob, session string, items []models.File) {
+	cp := &copier{
+		ctx:         ctx,
+		cancel:      cancel,
+		db:          database.DB,
+		job:         job,
+		channelUser: strconv.FormatInt(job.UserId, 10),
+		channels:    make(map[int64]*tg.InputChannel),
+	}
+
+	stopHeartbeat := cp.heartbeat()
+
+	err := cp.run(session, items)
+
+	stopHeartbeat()
+
+	status := copyDone
+
+	var msg *string
+
+	switch {
+	case ctx.Err() != nil && copyShutdown.Load():
+		status, msg = copyFailed, utils.StringPointer("interrupted by shutdown")
+	case ctx.Err() != nil:
+		status = copyCancelled
+	case err != nil:
+		status, msg = copyFailed, utils.StringPointer(err.Error())
+		utils.Logger.Warn("copy job failed", zap.String("job", job.ID), zap.Error(err))
+	}
+
+	job.Status, job.Error = status, msg
+
+	cp.db.Model(&models.CopyJob{}).Where("id = ?", job.ID).Where("status IN ?", []string{copyRunning, copyCancelled}).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"error":         msg,
+			"copied_files":  job.CopiedFiles,
+			"skipped_files": job.SkippedFiles,
+			"failed_files":  job.FailedFiles,
+			"failures":      job.Failures,
+			"updated_at":    time.Now().UTC(),
+		})
+
+	event := cp.event()
+
+	switch status {
+	case copyDone:
+		event.Status = events.StatusDone
+	default:
+		event.Status = events.StatusFailed
+		event.Error = status
+		if msg != nil {
+			event.Error = *msg
+		}
+	}
+
+	events.Bus.Publish(job.UserId, event)
+}
+
+func (cp *copier) run(session string, items []models.File) error {
+	client, err := tgc.UserLogin(cp.ctx, session)
+
+	if err != nil {
+		return err
+	}
+
+	defer tgc.UserClients.Hold(client)()
+
+	cp.client = client
+
+	var dest []models.File
+
+	if err := cp.db.Raw("select * from teldrive.create_directories(?, ?)", cp.job.UserId, cp.job.Destination).
+		Scan(&dest).Error; err != nil || len(dest) == 0 {
+		return errors.New("failed to create destination")
+	}
+
+	return tgc.RunWithAuth(cp.ctx, client, "", func(ctx context.Context) error {
+		for i := range items {
+			name := items[i].Name
+			if cp.job.Name != nil {
+				name = *cp.job.Name
+			}
+			if err := cp.copyItem(&items[i], &dest[0], name); err != nil {
+				return err
+			}
+		}
+		return cp.flush()
+	})
+}
+
+func (cp *copier) copyItem(item *models.File, dest *models.File, name string) error {
+	if err := cp.ctx.Err(); err != nil {
+		return err
+	}
+
+	if item.Type != "folder" {
+		return cp.queueFile(item, dest, name)
+	}
+
+	if dest.Path == item.Path || strings.HasPrefix(dest.Path, item.Path+"/") {
+		return cp.failTree(item, "cannot copy a folder into itself")
+	}
+
+	folderPath := childPath(dest.Path, name)
+
+	fileIn := schemas.FileIn{
+		Name:     name,
+		Type:     "folder",
+		MimeType: "drive/folder",
+		Path:     folderPath,
+		Depth:    utils.IntPointer(len(strings.Split(folderPath, "/")) - 1),
+		UserID:   cp.job.UserId,
+		Starred:  utils.BoolPointer(false),
+		Status:   "active",
+		ParentID: dest.ID,
+	}
+
+	var (
+		folder  *models.File
+		outcome string
+		appErr  *types.AppError
+	)
+
+	err := cp.db.Transaction(func(tx *gorm.DB) error {
+		folder, outcome, appErr = createFile(tx, &fileIn, cp.job.Conflict)
+		if appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+
+	if appErr == nil && err != nil {
+		return err
+	}
+
+	if appErr != nil {
+		if appErr.Code == http.StatusConflict {
+			return cp.failTree(item, appErr.Error.Error())
+		}
+		return appErr.Error
+	}
+
+	if outcome == OutcomeSkipped {
+		stats, err := copyTree(cp.db, cp.job.UserId, []string{item.ID})
+		if err != nil {
+			return err
+		}
+		cp.job.SkippedFiles += stats.Files
+		return cp.report(false)
+	}
+
+	var children []models.File
+
+	if err := cp.db.Where("parent_id = ?", item.ID).Where("user_id = ?", cp.job.UserId).Where("status = ?", "active").
+		Order("type DESC").Order("name").Find(&children).Error; err != nil {
+		return err
+	}
+
+	for i := range children {
+		if err := cp.copyItem(&children[i], folder, children[i].Name); err != nil {
+			return err
+		}
+	}
+
+	return cp.report(false)
+}
+
+// queueFile adds a file to the batch forwarded next. Conflicts refused by
+// the policy are settled before any message is forwarded.
+func (cp *copier) queueFile(file *models.File, dest *models.File, name string) error {
+	if file.Parts == nil || len(*file.Parts) == 0 || file.ChannelID == nil {
+		cp.fail(file, "file has no parts")
+		return cp.report(false)
+	}
+
+	existing, err := findByName(cp.db, cp.job.UserId, dest.ID, name, "")
+
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		switch cp.job.Conflict {
+		case ConflictFail:
+			cp.fail(file, errFileExists.Error())
+			return cp.report(false)
+		case ConflictSkip:
+			cp.job.SkippedFiles++
+			return cp.report(false)
+		}
+	}
+
+	parts := len(*file.Parts)
+
+	if len(cp.batch) > 0 && (*cp.batch[0].file.ChannelID != *file.ChannelID || cp.batchParts+parts > copyBatchSize) {
+		if err := cp.flush(); err != nil {
+			return err
+		}
+	}
+
+	cp.batch = append(cp.batch, copyTask{file: file, dest: dest, name: name})
+
+	cp.batchParts += parts
+
+	if cp.batchParts >= copyBatchSize {
+		return cp.flush()
+	}
+
+	return nil
+}
+
+// flush forwards the messages of the queued files and creates their copies.
+func (cp *copier) flush() error {
+	if len(cp.batch) == 0 {
+		return nil
+	}
+
+	batch := cp.batch
+
+	cp.batch, cp.batchParts = nil, 0
+
+	channelId := *batch[0].file.ChannelID
+
+	ids := []int{}
+
+	for _, task := range batch {
+		for _, part := range *task.file.Parts {
+			ids = append(ids, int(part.ID))
+		}
+	}
+
+	newIds, err := cp.forward(channelId, ids)
+
+	if err != nil {
+		cp.discard(channelId, newIds)
+		if cp.ctx.Err() != nil {
+			return cp.ctx.Err()
+		}
+		for _, task := range batch {
+			cp.fail(task.file, err.Error())
+		}
+		return cp.report(true)
+	}
+
+	offset := 0
+
+	for _, task := range batch {
+		parts := models.Parts{}
+
+		taskIds := newIds[offset : offset+len(*task.file.Parts)]
+
+		offset += len(taskIds)
+
+		for _, id := range taskIds {
+			parts = append(parts, models.Part{ID: int64(id)})
+		}
+
+		fileIn := schemas.FileIn{
+			Name:      task.name,
+			Type:      "file",
+			MimeType:  task.file.MimeType,
+			Size:      task.file.Size,
+			Parts:     &parts,
+			UserID:    cp.job.UserId,
+			Starred:   utils.BoolPointer(false),
+			Status:    "active",
+			ParentID:  task.dest.ID,
+			ChannelID: channelId,
+		}
+
+		var appErr *types.AppError
+
+		err := cp.db.Transaction(func(tx *gorm.DB) error {
+			_, _, appErr = createFile(tx, &fileIn, cp.job.Conflict)
+			if appErr != nil {
+				return appErr.Error
+			}
+			return nil
+		})
+
+		if appErr != nil {
+			cp.discard(channelId, taskIds)
+			cp.fail(task.file, appErr.Error.Error())
+			continue
+		}
+
+		if err != nil {
+			cp.discard(channelId, taskIds)
+			cp.fail(task.file, "failed to create a file")
+			continue
+		}
+
+		cp.job.CopiedFiles++
+	}
+
+	return cp.report(true)
+}
+
+// forward copies messages within a channel and returns the new ids in the
+// order of ids. On error the ids forwarded so far are returned as well.
+func (cp *copier) forward(channelId int64, ids []int) ([]int, error) {
+	channel, ok := cp.channels[channelId]
+
+	if !ok {
+		var err error
+		channel, err = GetChannelById(cp.ctx, cp.client, channelId, cp.channelUser)
+		if err != nil {
+			return nil, err
+		}
+		cp.channels[channelId] = channel
+	}
+
+	peer := &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}
+
+	newIds := make([]int, 0, len(ids))
+
+	for start := 0; start < len(ids); start += copyBatchSize {
+		chunk := ids[start:utils.Min(start+copyBatchSize, len(ids))]
+
+		randomIds := make([]int64, len(chunk))
+
+		for i := range randomIds {
+			randomIds[i], _ = RandInt64()
+		}
+
+		res, err := cp.client.API().MessagesForwardMessages(cp.ctx, &tg.MessagesForwardMessagesRequest{
+			Silent:   true,
+			FromPeer: peer,
+			ToPeer:   peer,
+			ID:       chunk,
+			RandomID: randomIds,
+		})
+
+		if err != nil {
+			return newIds, err
+		}
+
+		updates, ok := res.(*tg.Updates)
+
+		if !ok {
+			return newIds, fmt.Errorf("unexpected type %T", res)
+		}
+
+		byRandom := make(map[int64]int)
+
+		for _, update := range updates.Updates {
+			if msg, ok := update.(*tg.UpdateMessageID); ok {
+				byRandom[msg.RandomID] = msg.ID
+			}
+		}
+
+		var missing error
+
+		for i, randomId := range randomIds {
+			id, ok := byRandom[randomId]
+			if !ok {
+				missing = fmt.Errorf("message %d was not forwarded", chunk[i])
+				continue
+			}
+			newIds = append(newIds, id)
+		}
+
+		if missing != nil {
+			return newIds, missing
+		}
+	}
+
+	return newIds, nil
+}
+
+// discard deletes forwarded messages no file was created for. It runs after
+// the job was cancelled as well, so it doesn't use the job context.
+func (cp *copier) discard(channelId int64, ids []int) {
+	channel, ok := cp.channels[channelId]
+
+	if len(ids) == 0 || !ok {
+		return
+	}
+
+	ctx := context.WithoutCancel(cp.ctx)
+
+	_, err := cp.client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids})
+
+	if err != nil {
+		utils.Logger.Warn("failed to delete forwarded messages", zap.String("job", cp.job.ID),
+			zap.Ints("ids", ids), zap.Error(err))
+	}
+}
+
+func (cp *copier) fail(file *models.File, msg string) {
+	cp.job.FailedFiles++
+	if len(cp.job.Failures) < maxCopyFailures {
+		cp.job.Failures = append(cp.job.Failures, models.CopyFailure{ID: file.ID, Name: file.Name, Error: msg})
+	}
+}
+
+// failTree reports a folder that can't be copied, its files count as failed.
+func (cp *copier) failTree(folder *models.File, msg string) error {
+	stats, err := copyTree(cp.db, cp.job.UserId, []string{folder.ID})
+
+	if err != nil {
+		return err
+	}
+
+	cp.fail(folder, msg)
+
+	cp.job.FailedFiles += stats.Files - 1
+
+	if stats.Files == 0 {
+		cp.job.FailedFiles++
+	}
+
+	return cp.report(false)
+}
+
+func (cp *copier) event() events.Event {
+	return events.Event{
+		Type:   events.TypeCopy,
+		ID:     cp.job.ID,
+		Status: events.StatusRunning,
+		Done:   int64(cp.job.CopiedFiles + cp.job.SkippedFiles + cp.job.FailedFiles),
+		Total:  int64(cp.job.TotalFiles),
+	}
+}
+
+// heartbeat keeps the job marked alive until the returned function is
+// called. A job cancelled on another instance is stopped here as well.
+func (cp *copier) heartbeat() func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(copyHeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				res := cp.db.Model(&models.CopyJob{}).Where("id = ?", cp.job.ID).Where("status = ?", copyRunning).
+					Update("updated_at", time.Now().UTC())
+				if res.Error == nil && res.RowsAffected == 0 {
+					cp.cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// report stores the progress of the job and stops it when it was cancelled
+// in the meantime. Unless forced it writes at most every copyReportInterval.
+func (cp *copier) report(force bool) error {
+	if !force && time.Since(cp.lastReport) < copyReportInterval {
+		return nil
+	}
+
+	cp.lastReport = time.Now()
+
+	res := cp.db.Model(&models.CopyJob{}).Where("id = ?", cp.job.ID).Where("status = ?", copyRunning).
+		Updates(map[string]interface{}{
+			"copied_files":  cp.job.CopiedFiles,
+			"skipped_files": cp.job.SkippedFiles,
+			"failed_files":  cp.job.FailedFiles,
+			"failures":      cp.job.Failures,
+			"updated_at":    time.Now().UTC(),
+		})
+
+	if res.Error == nil && res.RowsAffected == 0 {
+		cp.cancel()
+		return context.Canceled
+	}
+
+	events.Bus.Publish(cp.job.UserId, cp.event())
+
+	return nil
+}
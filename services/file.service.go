@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/utils"
 	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/events"
 	"github.com/divyam234/teldrive/utils/md5"
 	"github.com/divyam234/teldrive/utils/reader"
 	"github.com/divyam234/teldrive/utils/tgc"
@@ -73,14 +75,92 @@ func (fs *FileService) CreateFile(c *gin.Context) (*schemas.FileOut, *types.AppE
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
+	policy, appErr := parseConflictPolicy(fileIn.Conflict)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := prepareFileIn(c, fs.Db, &fileIn, userId); err != nil {
+		return nil, err
+	}
+
+	var (
+		fileDb  *models.File
+		outcome string
+	)
+
+	err := fs.Db.Transaction(func(tx *gorm.DB) error {
+		fileDb, outcome, appErr = createFile(tx, &fileIn, policy)
+		if appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create a file"), Code: http.StatusInternalServerError}
+	}
+
+	res := mapper.MapFileToFileOut(*fileDb)
+
+	res.Outcome = outcome
+
+	return &res, nil
+}
+
+// createFile stores a prepared file or folder, applying the conflict policy
+// when its name is taken. Skipped and merged items return the existing one.
+func createFile(tx *gorm.DB, fileIn *schemas.FileIn, policy string) (*models.File, string, *types.AppError) {
+	res, appErr := resolveConflict(tx, fileIn.UserID, fileIn.ParentID, fileIn.Name, fileIn.Type, policy, "")
+
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	if res.Outcome == OutcomeSkipped || res.Outcome == OutcomeMerged {
+		return res.Existing, res.Outcome, nil
+	}
+
+	if fileIn.Type == "folder" && res.Name != fileIn.Name {
+		fileIn.Path = childPath(path.Dir(fileIn.Path), res.Name)
+	}
+
+	fileIn.Name = res.Name
+
+	fileDb := mapper.MapFileInToFile(*fileIn)
+
+	if err := tx.Create(&fileDb).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, "", &types.AppError{Error: errFileExists, Code: http.StatusConflict}
+		}
+		return nil, "", &types.AppError{Error: errors.New("failed to create a file"), Code: http.StatusInternalServerError}
+	}
+
+	return &fileDb, res.Outcome, nil
+}
+
+// prepareFileIn resolves the parent folder and channel of a new file or
+// folder and applies scope, upload policy and quota checks.
+func prepareFileIn(c *gin.Context, db *gorm.DB, fileIn *schemas.FileIn, userId int64) *types.AppError {
 	fileIn.Path = strings.TrimSpace(fileIn.Path)
 
 	if fileIn.Path != "" {
+		if err := checkPathScope(c, fileIn.Path); err != nil {
+			return err
+		}
 		var parent models.File
-		if err := fs.Db.Where("type = ? AND path = ?", "folder", fileIn.Path).First(&parent).Error; err != nil {
-			return nil, &types.AppError{Error: errors.New("parent directory not found"), Code: http.StatusNotFound}
+		if err := db.Where("type = ? AND path = ?", "folder", fileIn.Path).First(&parent).Error; err != nil {
+			return &types.AppError{Error: errors.New("parent directory not found"), Code: http.StatusNotFound}
 		}
 		fileIn.ParentID = parent.ID
+	} else if err := checkFileScope(c, db, fileIn.ParentID); err != nil {
+		return err
 	}
 
 	if fileIn.Type == "folder" {
@@ -100,33 +180,51 @@ func (fs *FileService) CreateFile(c *gin.Context) (*schemas.FileOut, *types.AppE
 		if fileIn.ChannelID == 0 {
 			channelId, err = GetDefaultChannel(c, userId)
 			if err != nil {
-				return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+				return &types.AppError{Error: err, Code: http.StatusInternalServerError}
 			}
 		} else {
 			channelId = fileIn.ChannelID
 		}
 
 		fileIn.ChannelID = channelId
+
+		if mimeType := detectedMimeType(db, fileIn, userId); mimeType != "" {
+			fileIn.MimeType = mimeType
+		}
+
+		if err := checkUploadPolicy(fileIn.Name, fileIn.MimeType, fileIn.Size); err != nil {
+			return err
+		}
+		if err := checkQuota(userId, fileIn.Size, 1, false); err != nil {
+			return err
+		}
 	}
 
 	fileIn.UserID = userId
 	fileIn.Starred = utils.BoolPointer(false)
 	fileIn.Status = "active"
 
-	fileDb := mapper.MapFileInToFile(fileIn)
-
-	if err := fs.Db.Create(&fileDb).Error; err != nil {
-		pgErr := err.(*pgconn.PgError)
-		if pgErr.Code == "23505" {
-			return nil, &types.AppError{Error: errors.New("file exists"), Code: http.StatusBadRequest}
-		}
-		return nil, &types.AppError{Error: errors.New("failed to create a file"), Code: http.StatusBadRequest}
+	return nil
+}
 
+// detectedMimeType returns the type sniffed while the first part of the file
+// was uploaded, or an empty string when the upload is unknown.
+func detectedMimeType(db *gorm.DB, fileIn *schemas.FileIn, userId int64) string {
+	if fileIn.Parts == nil || len(*fileIn.Parts) == 0 {
+		return ""
 	}
 
-	res := mapper.MapFileToFileOut(fileDb)
+	var detected []string
 
-	return &res, nil
+	db.Model(&models.Upload{}).Where("user_id = ?", userId).Where("channel_id = ?", fileIn.ChannelID).
+		Where("part_id = ?", (*fileIn.Parts)[0].ID).Where("part_no = 1").Where("mime_type is not null").
+		Limit(1).Pluck("mime_type", &detected)
+
+	if len(detected) == 0 {
+		return ""
+	}
+
+	return detected[0]
 }
 
 func (fs *FileService) UpdateFile(c *gin.Context) (*schemas.FileOut, *types.AppError) {
@@ -141,15 +239,43 @@ func (fs *FileService) UpdateFile(c *gin.Context) (*schemas.FileOut, *types.AppE
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
-	if fileUpdate.Type == "folder" && fileUpdate.Name != "" {
-		if err := fs.Db.Raw("select * from teldrive.update_folder(?, ?)", fileID, fileUpdate.Name).Scan(&files).Error; err != nil {
-			return nil, &types.AppError{Error: errors.New("failed to update the file"), Code: http.StatusInternalServerError}
+	if err := checkFileScope(c, fs.Db, fileID); err != nil {
+		return nil, err
+	}
+
+	version, appErr := ifMatchVersion(c)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	err := fs.Db.Transaction(func(tx *gorm.DB) error {
+		if version != nil {
+			if appErr = checkFileVersions(tx, map[string]int{fileID: *version}); appErr != nil {
+				return appErr.Error
+			}
 		}
-	} else {
-		fileDb := mapper.MapFileInToFile(fileUpdate)
-		if err := fs.Db.Model(&files).Clauses(clause.Returning{}).Where("id = ?", fileID).Updates(fileDb).Error; err != nil {
-			return nil, &types.AppError{Error: errors.New("failed to update the file"), Code: http.StatusInternalServerError}
+		if fileUpdate.Type == "folder" && fileUpdate.Name != "" {
+			if err := tx.Raw("select * from teldrive.update_folder(?, ?)", fileID, fileUpdate.Name).Scan(&files).Error; err != nil {
+				appErr = &types.AppError{Error: errors.New("failed to update the file"), Code: http.StatusInternalServerError}
+				return err
+			}
+		} else {
+			fileDb := mapper.MapFileInToFile(fileUpdate)
+			if err := tx.Model(&files).Clauses(clause.Returning{}).Where("id = ?", fileID).Updates(fileDb).Error; err != nil {
+				appErr = &types.AppError{Error: errors.New("failed to update the file"), Code: http.StatusInternalServerError}
+				return err
+			}
 		}
+		return nil
+	})
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to update the file"), Code: http.StatusInternalServerError}
 	}
 
 	if len(files) == 0 {
@@ -170,6 +296,10 @@ func (fs *FileService) GetFileByID(c *gin.Context) (*schemas.FileOutFull, error)
 
 	fileID := c.Param("fileID")
 
+	if err := checkFileScope(c, fs.Db, fileID); err != nil {
+		return nil, err.Error
+	}
+
 	var file []models.File
 
 	fs.Db.Model(&models.File{}).Where("id = ?", fileID).Find(&file)
@@ -211,6 +341,9 @@ func (fs *FileService) ListFiles(c *gin.Context) (*schemas.FileResponse, *types.
 		err    error
 	)
 	if fileQuery.Path != "" {
+		if err := checkPathScope(c, fileQuery.Path); err != nil {
+			return nil, err
+		}
 		pathId, err = fs.getPathId(fileQuery.Path)
 		if err != nil {
 			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
@@ -220,6 +353,8 @@ func (fs *FileService) ListFiles(c *gin.Context) (*schemas.FileResponse, *types.
 	query := fs.Db.Model(&models.File{}).Limit(pagingParams.PerPage).
 		Where(map[string]interface{}{"user_id": userId, "status": "active"})
 
+	query = scopeFilesQuery(c, query)
+
 	if fileQuery.Op == "list" {
 		setOrderFilter(query, &pagingParams, &sortingParams)
 
@@ -298,6 +433,10 @@ func (fs *FileService) MakeDirectory(c *gin.Context) (*schemas.FileOut, *types.A
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
+	if err := checkPathScope(c, payload.Path); err != nil {
+		return nil, err
+	}
+
 	userId, _ := getUserAuth(c)
 	if err := fs.Db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Path).Scan(&files).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to create directories"), Code: http.StatusInternalServerError}
@@ -309,27 +448,97 @@ func (fs *FileService) MakeDirectory(c *gin.Context) (*schemas.FileOut, *types.A
 
 }
 
-func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppError) {
+func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *schemas.CopyJobOut, *types.AppError) {
 
 	var payload schemas.Copy
 
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+		return nil, nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
-	userId, session := getUserAuth(c)
+	items := payload.Files
+
+	if len(items) == 0 {
+		items = []string{payload.ID}
+	}
 
-	client, _ := tgc.UserLogin(c, session)
+	if err := checkFileScope(c, fs.Db, items...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkPathScope(c, payload.Destination); err != nil {
+		return nil, nil, err
+	}
+
+	policy, appErr := parseConflictPolicy(payload.Conflict)
+
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	userId, session := getUserAuth(c)
 
 	var res []models.File
 
-	fs.Db.Model(&models.File{}).Where("id = ?", payload.ID).Find(&res)
+	if err := fs.Db.Where("id IN ?", items).Where("user_id = ?", userId).Where("status = ?", "active").
+		Find(&res).Error; err != nil {
+		return nil, nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if len(res) != len(items) {
+		return nil, nil, &types.AppError{Error: errors.New("file not found"), Code: http.StatusNotFound}
+	}
+
+	// folders and selections run as a background job
+	if len(res) > 1 || res[0].Type == "folder" {
+		job, appErr := startCopyJob(fs.Db, userId, session, res, &payload, policy)
+		return nil, job, appErr
+	}
 
 	file := res[0]
 
+	if payload.Name == "" {
+		payload.Name = file.Name
+	}
+
+	if err := checkQuota(userId, file.Size, 1, false); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := tgc.UserLogin(c, session)
+
+	if err != nil {
+		return nil, nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	var destRes []models.File
+
+	if err := fs.Db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Destination).Scan(&destRes).Error; err != nil {
+		return nil, nil, &types.AppError{Error: errors.New("failed to create destination"), Code: http.StatusInternalServerError}
+	}
+
+	dest := destRes[0]
+
+	// settle fail and skip before forwarding any message
+	if existing, err := findByName(fs.Db, userId, dest.ID, payload.Name, ""); err == nil && existing != nil {
+		switch policy {
+		case ConflictFail:
+			return nil, nil, &types.AppError{Error: errFileExists, Code: http.StatusConflict}
+		case ConflictSkip:
+			out := mapper.MapFileToFileOut(*existing)
+			out.Outcome = OutcomeSkipped
+			return &out, nil, nil
+		}
+	}
+
 	newIds := models.Parts{}
 
-	err := tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+	progress := events.Event{Type: events.TypeCopy, ID: file.ID, Name: payload.Name,
+		Status: events.StatusRunning, Total: int64(len(*file.Parts))}
+
+	events.Bus.Publish(userId, progress)
+
+	err = tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
 		user := strconv.FormatInt(userId, 10)
 		messages, err := getTGMessages(c, client, *file.Parts, *file.ChannelID, user)
 		if err != nil {
@@ -372,47 +581,67 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 			}
 			newIds = append(newIds, models.Part{ID: int64(msg.ID)})
 
+			progress.Done = int64(len(newIds))
+			events.Bus.Publish(userId, progress)
+
 		}
 		return nil
 	})
 
 	if err != nil {
-		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		progress.Status, progress.Error = events.StatusFailed, err.Error()
+		events.Bus.Publish(userId, progress)
+		return nil, nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
 	}
 
-	var destRes []models.File
-
-	if err := fs.Db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Destination).Scan(&destRes).Error; err != nil {
-		return nil, &types.AppError{Error: errors.New("failed to create destination"), Code: http.StatusInternalServerError}
+	fileIn := schemas.FileIn{
+		Name:      payload.Name,
+		Size:      file.Size,
+		Type:      file.Type,
+		MimeType:  file.MimeType,
+		Parts:     &newIds,
+		UserID:    userId,
+		Starred:   utils.BoolPointer(false),
+		Status:    "active",
+		ParentID:  dest.ID,
+		ChannelID: *file.ChannelID,
 	}
 
-	dest := destRes[0]
-
-	dbFile := models.File{}
+	var (
+		dbFile  *models.File
+		outcome string
+	)
 
-	dbFile.Name = payload.Name
-	dbFile.Size = file.Size
-	dbFile.Type = file.Type
-	dbFile.MimeType = file.MimeType
-	dbFile.Parts = &newIds
-	dbFile.UserID = userId
-	dbFile.Starred = utils.BoolPointer(false)
-	dbFile.Status = "active"
-	dbFile.ParentID = dest.ID
-	dbFile.ChannelID = file.ChannelID
+	err = fs.Db.Transaction(func(tx *gorm.DB) error {
+		dbFile, outcome, appErr = createFile(tx, &fileIn, policy)
+		if appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
 
-	if err := fs.Db.Create(&dbFile).Error; err != nil {
-		return nil, &types.AppError{Error: errors.New("failed to copy file"), Code: http.StatusBadRequest}
+	if appErr == nil && err != nil {
+		appErr = &types.AppError{Error: errors.New("failed to create a file"), Code: http.StatusInternalServerError}
+	}
 
+	if appErr != nil {
+		progress.Status, progress.Error = events.StatusFailed, appErr.Error.Error()
+		events.Bus.Publish(userId, progress)
+		return nil, nil, appErr
 	}
 
-	out := mapper.MapFileToFileOut(dbFile)
+	progress.Status = events.StatusDone
+	events.Bus.Publish(userId, progress)
+
+	out := mapper.MapFileToFileOut(*dbFile)
 
-	return &out, nil
+	out.Outcome = outcome
+
+	return &out, nil, nil
 
 }
 
-func (fs *FileService) MoveFiles(c *gin.Context) (*schemas.Message, *types.AppError) {
+func (fs *FileService) MoveFiles(c *gin.Context) (*schemas.FileOperationResult, *types.AppError) {
 
 	var payload schemas.FileOperation
 
@@ -420,18 +649,116 @@ func (fs *FileService) MoveFiles(c *gin.Context) (*schemas.Message, *types.AppEr
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
+	if err := checkFileScope(c, fs.Db, payload.Files...); err != nil {
+		return nil, err
+	}
+
+	if err := checkPathScope(c, payload.Destination); err != nil {
+		return nil, err
+	}
+
+	policy, appErr := parseConflictPolicy(payload.Conflict)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	userId, _ := getUserAuth(c)
+
 	var destination models.File
 
-	if err := fs.Db.Model(&models.File{}).Select("id").Where("path = ?", payload.Destination).First(&destination).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+	if err := fs.Db.Model(&models.File{}).Select("id", "path").Where("type = ? AND path = ? AND user_id = ?", "folder", payload.Destination, userId).
+		First(&destination).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, &types.AppError{Error: errors.New("destination not found"), Code: http.StatusNotFound}
 
 	}
 
-	if err := fs.Db.Model(&models.File{}).Where("id IN ?", payload.Files).UpdateColumn("parent_id", destination.ID).Error; err != nil {
+	versions, appErr := fileOperationVersions(c, &payload)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	items := []schemas.FileOperationItem{}
+
+	err := fs.Db.Transaction(func(tx *gorm.DB) error {
+		if appErr = checkFileVersions(tx, versions); appErr != nil {
+			return appErr.Error
+		}
+
+		var files []models.File
+
+		if err := tx.Where("id IN ?", payload.Files).Where("user_id = ?", userId).Find(&files).Error; err != nil {
+			appErr = &types.AppError{Error: errors.New("move failed"), Code: http.StatusInternalServerError}
+			return err
+		}
+
+		for i := range files {
+			item, err := moveWithPolicy(tx, userId, &files[i], &destination, policy)
+			if err != nil {
+				appErr = &types.AppError{Error: errors.New("move failed"), Code: http.StatusInternalServerError}
+				return err
+			}
+			items = append(items, item)
+		}
+
+		return nil
+	})
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err != nil {
 		return nil, &types.AppError{Error: errors.New("move failed"), Code: http.StatusInternalServerError}
 	}
 
-	return &schemas.Message{Status: true, Message: "files moved"}, nil
+	return &schemas.FileOperationResult{Status: true, Message: "files moved", Items: items}, nil
+}
+
+// moveWithPolicy moves one item into dest and reports what happened to it.
+// Conflicts that the policy refuses are reported, not returned as errors.
+func moveWithPolicy(tx *gorm.DB, userId int64, file *models.File, dest *models.File, policy string) (schemas.FileOperationItem, error) {
+	item := schemas.FileOperationItem{ID: file.ID, Name: file.Name, Outcome: OutcomeDone}
+
+	if file.ParentID == dest.ID {
+		return item, nil
+	}
+
+	if file.Type == "folder" && (dest.Path == file.Path || strings.HasPrefix(dest.Path, file.Path+"/")) {
+		item.Outcome, item.Error = OutcomeFailed, "cannot move a folder into itself"
+		return item, nil
+	}
+
+	res, appErr := resolveConflict(tx, userId, dest.ID, file.Name, file.Type, policy, file.ID)
+
+	if appErr != nil {
+		if appErr.Code == http.StatusConflict {
+			item.Outcome, item.Error = OutcomeFailed, appErr.Error.Error()
+			return item, nil
+		}
+		return item, appErr.Error
+	}
+
+	switch res.Outcome {
+	case OutcomeSkipped:
+	case OutcomeMerged:
+		if err := mergeFolders(tx, userId, file, res.Existing); err != nil {
+			return item, err
+		}
+	default:
+		if err := moveItem(tx, file, dest, res.Name); err != nil {
+			return item, err
+		}
+	}
+
+	if res.Outcome != "" {
+		item.Outcome = res.Outcome
+	}
+
+	item.Name = res.Name
+
+	return item, nil
 }
 
 func (fs *FileService) DeleteFiles(c *gin.Context) (*schemas.Message, *types.AppError) {
@@ -442,6 +769,10 @@ func (fs *FileService) DeleteFiles(c *gin.Context) (*schemas.Message, *types.App
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
+	if err := checkFileScope(c, fs.Db, payload.Files...); err != nil {
+		return nil, err
+	}
+
 	if err := fs.Db.Exec("call teldrive.delete_files($1)", payload.Files).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to delete files"), Code: http.StatusInternalServerError}
 	}
@@ -449,7 +780,7 @@ func (fs *FileService) DeleteFiles(c *gin.Context) (*schemas.Message, *types.App
 	return &schemas.Message{Status: true, Message: "files deleted"}, nil
 }
 
-func (fs *FileService) MoveDirectory(c *gin.Context) (*schemas.Message, *types.AppError) {
+func (fs *FileService) MoveDirectory(c *gin.Context) (*schemas.FileOperationResult, *types.AppError) {
 
 	var payload schemas.DirMove
 
@@ -457,13 +788,97 @@ func (fs *FileService) MoveDirectory(c *gin.Context) (*schemas.Message, *types.A
 		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
 	}
 
+	if err := checkPathScope(c, payload.Source); err != nil {
+		return nil, err
+	}
+
+	if err := checkPathScope(c, payload.Destination); err != nil {
+		return nil, err
+	}
+
 	userId, _ := getUserAuth(c)
 
-	if err := fs.Db.Exec("select * from teldrive.move_directory(? , ? , ?)", payload.Source, payload.Destination, userId).Error; err != nil {
+	version, appErr := ifMatchVersion(c)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	policy, appErr := parseConflictPolicy(payload.Conflict)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	destination := path.Clean("/" + strings.TrimSpace(payload.Destination))
+
+	var item schemas.FileOperationItem
+
+	err := fs.Db.Transaction(func(tx *gorm.DB) error {
+		var source models.File
+		if err := tx.Where("type = ? AND path = ? AND user_id = ?", "folder", payload.Source, userId).
+			First(&source).Error; err != nil {
+			appErr = &types.AppError{Error: errors.New("source not found"), Code: http.StatusNotFound}
+			return err
+		}
+
+		if version != nil {
+			if appErr = checkFileVersions(tx, map[string]int{source.ID: *version}); appErr != nil {
+				return appErr.Error
+			}
+		}
+
+		item = schemas.FileOperationItem{ID: source.ID, Name: path.Base(destination), Outcome: OutcomeDone}
+
+		var parents []models.File
+
+		if err := tx.Where("type = ? AND path = ? AND user_id = ?", "folder", path.Dir(destination), userId).
+			Limit(1).Find(&parents).Error; err != nil {
+			appErr = &types.AppError{Error: errors.New("failed to move directory"), Code: http.StatusInternalServerError}
+			return err
+		}
+
+		// a missing parent is created by move_directory and can't conflict
+		if len(parents) > 0 && destination != source.Path {
+			res, resErr := resolveConflict(tx, userId, parents[0].ID, item.Name, "folder", policy, source.ID)
+			if resErr != nil {
+				appErr = resErr
+				return resErr.Error
+			}
+			if res.Outcome != "" {
+				item.Outcome = res.Outcome
+			}
+			switch res.Outcome {
+			case OutcomeSkipped:
+				return nil
+			case OutcomeMerged:
+				if err := mergeFolders(tx, userId, &source, res.Existing); err != nil {
+					appErr = &types.AppError{Error: errors.New("failed to merge directories"), Code: http.StatusInternalServerError}
+					return err
+				}
+				return nil
+			case OutcomeRenamed:
+				item.Name = res.Name
+				destination = childPath(parents[0].Path, res.Name)
+			}
+		}
+
+		if err := tx.Exec("select * from teldrive.move_directory(? , ? , ?)", payload.Source, destination, userId).Error; err != nil {
+			appErr = &types.AppError{Error: errors.New("failed to move directory"), Code: http.StatusInternalServerError}
+			return err
+		}
+		return nil
+	})
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to move directory"), Code: http.StatusInternalServerError}
 	}
 
-	return &schemas.Message{Status: true, Message: "directory moved"}, nil
+	return &schemas.FileOperationResult{Status: true, Message: "directory moved", Items: []schemas.FileOperationItem{item}}, nil
 }
 
 func (fs *FileService) GetFileStream(c *gin.Context) {
@@ -559,7 +974,11 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 
 	if config.LazyStreamBots {
 		tgc.Workers.Set(tokens, *file.ChannelID)
-		token = tgc.Workers.Next(*file.ChannelID)
+		token, err = tgc.Workers.Next(*file.ChannelID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		client, _ := tgc.BotLogin(c, token)
 		channelUser = strings.Split(token, ":")[0]
 		if r.Method != "HEAD" {
@@ -580,26 +999,27 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 		var client *tgc.Client
 
 		if config.DisableStreamBots || len(tokens) == 0 {
-			tgClient, _ := tgc.UserLogin(c, session.Session)
-			client, err = tgc.StreamWorkers.UserWorker(tgClient)
+			tgClient, err := tgc.UserLogin(c, session.Session)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			defer tgc.UserClients.Hold(tgClient)()
+			client = &tgc.Client{Tg: tgClient, Status: "running"}
 			channelUser = strconv.FormatInt(session.UserId, 10)
 		} else {
-			var index int
+			var token string
 			limit := utils.Min(len(tokens), config.BgBotsLimit)
 
 			tgc.StreamWorkers.Set(tokens[:limit], *file.ChannelID)
 
-			client, index, err = tgc.StreamWorkers.Next(*file.ChannelID)
+			client, token, err = tgc.StreamWorkers.Next(*file.ChannelID)
 
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			channelUser = strings.Split(tokens[index], ":")[0]
+			channelUser = strings.Split(token, ":")[0]
 
 		}
 
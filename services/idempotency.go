@@ -0,0 +1,57 @@
+package services
+
+import (
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/utils"
+	"gorm.io/gorm/clause"
+)
+
+// ClaimIdempotencyKey records key as in progress for userId. When the key is
+// already known the existing record is returned with claimed set to false.
+// Keys older than the retention window are treated as unused.
+func ClaimIdempotencyKey(userId int64, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	db := database.DB
+
+	expired := time.Now().UTC().Add(-utils.GetConfig().IdempotencyRetention)
+
+	if err := db.Where("user_id = ? AND key = ?", userId, key).Where("created_at < ?", expired).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	record := &models.IdempotencyKey{UserID: userId, Key: key, RequestHash: requestHash}
+
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+
+	if res.RowsAffected == 1 {
+		return record, true, nil
+	}
+
+	var existing models.IdempotencyKey
+
+	if err := db.Where("user_id = ? AND key = ?", userId, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+
+	return &existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response to replay for later requests
+// with the same key.
+func CompleteIdempotencyKey(userId int64, key string, statusCode int, contentType string, body []byte) error {
+	return database.DB.Model(&models.IdempotencyKey{}).Where("user_id = ? AND key = ?", userId, key).
+		Updates(map[string]interface{}{"status_code": statusCode, "content_type": contentType, "response": body}).Error
+}
+
+// ReleaseIdempotencyKey forgets a key whose request can't be replayed, so it
+// can be retried.
+func ReleaseIdempotencyKey(userId int64, key string) error {
+	return database.DB.Where("user_id = ? AND key = ?", userId, key).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/mapper"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/events"
+	"github.com/divyam234/teldrive/utils/mimetype"
+	"github.com/divyam234/teldrive/utils/tgc"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	jobQueued    = "queued"
+	jobUploading = "uploading"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// errJobCancelled is returned when the upload of a running job was deleted.
+var errJobCancelled = errors.New("upload cancelled")
+
+// ingestCancels holds the cancel functions of jobs running here.
+var ingestCancels sync.Map
+
+// ingestWake nudges the workers when a job is queued so they don't wait for
+// the next poll.
+var ingestWake = make(chan struct{}, 1)
+
+// ingestProgress holds the bytes sent so far by running jobs.
+var ingestProgress sync.Map
+
+type progressReader struct {
+	r    io.Reader
+	sent *atomic.Int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent.Add(int64(n))
+	return n, err
+}
+
+func jobProgress(job *models.UploadJob) int64 {
+	if sent, ok := ingestProgress.Load(job.ID); ok {
+		return sent.(*atomic.Int64).Load()
+	}
+	return job.UploadedBytes
+}
+
+// StageUpload spools the request body to the staging directory and queues it
+// for the background workers, the client doesn't wait for Telegram.
+func (us *UploadService) StageUpload(c *gin.Context) (*schemas.UploadJobOut, *types.AppError) {
+
+	var (
+		uploadQuery schemas.UploadQuery
+		channelId   int64
+		err         error
+	)
+
+	uploadQuery.PartNo = 1
+	uploadQuery.TotalParts = 1
+
+	if err := c.ShouldBindQuery(&uploadQuery); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if uploadQuery.Filename == "" {
+		return nil, &types.AppError{Error: errors.New("filename missing"), Code: http.StatusBadRequest}
+	}
+
+	userId, _ := getUserAuth(c)
+
+	fileSize := c.Request.ContentLength
+
+	if fileSize <= 0 {
+		return nil, &types.AppError{Error: errors.New("content length required"), Code: http.StatusLengthRequired}
+	}
+
+	if err := checkUploadPolicy(uploadQuery.Filename, "", fileSize); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(userId, fileSize, 0, true); err != nil {
+		return nil, err
+	}
+
+	if uploadQuery.ChannelID == 0 {
+		channelId, err = GetDefaultChannel(c, userId)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		}
+	} else {
+		channelId = uploadQuery.ChannelID
+	}
+
+	stagingDir := utils.GetConfig().UploadStagingDir
+
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create staging dir"), Code: http.StatusInternalServerError}
+	}
+
+	tmp, err := os.CreateTemp(stagingDir, "upload-*")
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to stage upload"), Code: http.StatusInternalServerError}
+	}
+
+	written, err := io.Copy(tmp, io.LimitReader(c.Request.Body, fileSize+1))
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	tmp.Close()
+
+	if err != nil || written != fileSize {
+		os.Remove(tmp.Name())
+		if err == nil {
+			err = errors.New("body does not match content length")
+		}
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	job := &models.UploadJob{
+		UploadId:   c.Param("id"),
+		UserId:     userId,
+		Name:       uploadQuery.Filename,
+		PartNo:     uploadQuery.PartNo,
+		TotalParts: uploadQuery.TotalParts,
+		ChannelID:  channelId,
+		Size:       fileSize,
+		Path:       tmp.Name(),
+		Status:     jobQueued,
+	}
+
+	if err := us.Db.Create(job).Error; err != nil {
+		os.Remove(tmp.Name())
+		return nil, &types.AppError{Error: errors.New("failed to queue upload"), Code: http.StatusInternalServerError}
+	}
+
+	select {
+	case ingestWake <- struct{}{}:
+	default:
+	}
+
+	return mapper.MapUploadJobSchema(job), nil
+}
+
+func (us *UploadService) GetUploadStatus(c *gin.Context) (*schemas.UploadStatusOut, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	uploadId := c.Param("id")
+
+	var jobs []models.UploadJob
+
+	if err := us.Db.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Order("part_no").Find(&jobs).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if len(jobs) == 0 {
+		return nil, &types.AppError{Error: errors.New("upload not found"), Code: http.StatusNotFound}
+	}
+
+	return uploadStatus(uploadId, jobs), nil
+}
+
+func uploadStatus(uploadId string, jobs []models.UploadJob) *schemas.UploadStatusOut {
+	res := &schemas.UploadStatusOut{UploadId: uploadId, Status: jobDone, Jobs: []schemas.UploadJobOut{}}
+
+	counts := map[string]int{}
+
+	for _, job := range jobs {
+		job.UploadedBytes = jobProgress(&job)
+		res.Size += job.Size
+		res.UploadedBytes += job.UploadedBytes
+		counts[job.Status]++
+		res.Jobs = append(res.Jobs, *mapper.MapUploadJobSchema(&job))
+	}
+
+	switch {
+	case counts[jobCancelled] > 0:
+		res.Status = jobCancelled
+	case counts[jobFailed] > 0:
+		res.Status = jobFailed
+	case counts[jobUploading] > 0:
+		res.Status = jobUploading
+	case counts[jobQueued] > 0:
+		res.Status = jobQueued
+	}
+
+	if res.Size > 0 {
+		res.Progress = float64(res.UploadedBytes) / float64(res.Size) * 100
+	}
+
+	return res
+}
+
+var (
+	ingestStop context.CancelFunc
+	ingestWG   sync.WaitGroup
+)
+
+// StartIngest resumes jobs interrupted by a restart, drops the ones cancelled
+// while their worker was gone and starts the upload workers.
+func StartIngest() {
+	var cancelled []models.UploadJob
+
+	database.DB.Clauses(clause.Returning{}).Where("status = ?", jobCancelled).Delete(&cancelled)
+
+	for _, job := range cancelled {
+		os.Remove(job.Path)
+	}
+
+	database.DB.Model(&models.UploadJob{}).Where("status = ?", jobUploading).
+		Update("status", jobQueued)
+
+	var ctx context.Context
+
+	ctx, ingestStop = context.WithCancel(context.Background())
+
+	for i := 0; i < utils.Max(1, utils.GetConfig().UploadWorkers); i++ {
+		ingestWG.Add(1)
+		go func() {
+			defer ingestWG.Done()
+			ingestWorker(ctx)
+		}()
+	}
+}
+
+// StopIngest cancels running jobs and waits for the workers. Cancelled jobs
+// are queued again and picked up on the next start.
+func StopIngest() {
+	if ingestStop == nil {
+		return
+	}
+	ingestStop()
+	ingestWG.Wait()
+}
+
+func ingestWorker(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, err := claimJob()
+			if err != nil || job == nil {
+				break
+			}
+			runJob(ctx, job)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ingestWake:
+		}
+	}
+}
+
+func claimJob() (*models.UploadJob, error) {
+	var jobs []models.UploadJob
+
+	err := database.DB.Raw(`update teldrive.upload_jobs set status = ?, attempts = attempts + 1,
+	updated_at = timezone('utc'::text, now())
+	where id = (select id from teldrive.upload_jobs where status = ?
+	and next_attempt_at <= timezone('utc'::text, now())
+	order by created_at for update skip locked limit 1) returning *`, jobUploading, jobQueued).
+		Scan(&jobs).Error
+
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	return &jobs[0], nil
+}
+
+func runJob(ctx context.Context, job *models.UploadJob) {
+	sent := &atomic.Int64{}
+	ingestProgress.Store(job.ID, sent)
+	defer ingestProgress.Delete(job.ID)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	ingestCancels.Store(job.ID, cancel)
+	defer ingestCancels.Delete(job.ID)
+	defer cancel()
+
+	err := uploadJob(jobCtx, job, sent)
+
+	if errors.Is(err, errJobCancelled) || (jobCtx.Err() != nil && ctx.Err() == nil) {
+		os.Remove(job.Path)
+		database.DB.Where("id = ?", job.ID).Delete(&models.UploadJob{})
+		return
+	}
+
+	db := database.DB.Model(&models.UploadJob{}).Where("id = ?", job.ID).Where("status = ?", jobUploading)
+
+	event := events.Event{Type: events.TypeUpload, ID: job.UploadId, PartNo: job.PartNo,
+		Name: job.Name, Total: job.Size}
+
+	if err == nil {
+		event.Status, event.Done = events.StatusDone, job.Size
+		events.Bus.Publish(job.UserId, event)
+		os.Remove(job.Path)
+		db.Updates(map[string]interface{}{"status": jobDone, "uploaded_bytes": job.Size,
+			"error": nil, "updated_at": time.Now().UTC()})
+		return
+	}
+
+	if ctx.Err() != nil {
+		// shutting down, the job is resumed on the next start
+		db.Updates(map[string]interface{}{"status": jobQueued, "attempts": gorm.Expr("attempts - 1")})
+		return
+	}
+
+	utils.Logger.Warn("staged upload failed", zap.String("job", job.ID), zap.Int("attempt", job.Attempts), zap.Error(err))
+
+	msg := err.Error()
+
+	event.Error = msg
+
+	if job.Attempts >= utils.GetConfig().UploadMaxAttempts {
+		event.Status = events.StatusFailed
+		events.Bus.Publish(job.UserId, event)
+		os.Remove(job.Path)
+		db.Updates(map[string]interface{}{"status": jobFailed, "error": msg, "updated_at": time.Now().UTC()})
+		return
+	}
+
+	event.Status = events.StatusQueued
+	events.Bus.Publish(job.UserId, event)
+
+	backoff := time.Duration(1<<utils.Min(job.Attempts, 8)) * 10 * time.Second
+
+	db.Updates(map[string]interface{}{"status": jobQueued, "error": msg, "uploaded_bytes": 0,
+		"next_attempt_at": time.Now().UTC().Add(backoff), "updated_at": time.Now().UTC()})
+}
+
+func uploadJob(ctx context.Context, job *models.UploadJob, sent *atomic.Int64) error {
+	file, err := os.Open(job.Path)
+
+	if err != nil {
+		return fmt.Errorf("staged data missing: %w", err)
+	}
+
+	defer file.Close()
+
+	tokens, err := GetBotsToken(ctx, job.UserId, job.ChannelID)
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		client      *telegram.Client
+		token       string
+		channelUser string
+	)
+
+	if len(tokens) == 0 {
+		session, err := GetLatestSession(job.UserId)
+		if err != nil {
+			return errors.New("no active session for user")
+		}
+		client, err = tgc.UserLogin(ctx, session.Session)
+		if err != nil {
+			return err
+		}
+		channelUser = strconv.FormatInt(job.UserId, 10)
+	} else {
+		tgc.Workers.Set(tokens, job.ChannelID)
+		token, err = tgc.Workers.Next(job.ChannelID)
+		if err != nil {
+			return err
+		}
+		client, _ = tgc.BotLogin(ctx, token)
+		channelUser = strings.Split(token, ":")[0]
+	}
+
+	return tgc.RunWithAuth(ctx, client, token, func(ctx context.Context) error {
+		channel, err := GetChannelById(ctx, client, job.ChannelID, channelUser)
+
+		if err != nil {
+			return err
+		}
+
+		tuningKey := uploadTuningKey(token, job.UserId)
+
+		params := tgc.UploadTuner.Params(tuningKey, 0, 0, job.Size)
+
+		sent.Store(0)
+
+		progress := events.NewReader(file, job.UserId, events.Event{Type: events.TypeUpload, ID: job.UploadId,
+			PartNo: job.PartNo, Name: job.Name, Total: job.Size})
+
+		messageID, stats, err := sendDocument(ctx, client, channel, job.Name,
+			&progressReader{r: progress, sent: sent}, job.Size, params)
+
+		tgc.UploadTuner.Observe(tuningKey, params, stats)
+
+		if err != nil {
+			return err
+		}
+
+		part := &models.Upload{
+			Name:       job.Name,
+			UploadId:   job.UploadId,
+			PartId:     messageID,
+			ChannelID:  job.ChannelID,
+			Size:       job.Size,
+			PartNo:     job.PartNo,
+			TotalParts: job.TotalParts,
+			UserId:     job.UserId,
+		}
+
+		if job.PartNo == 1 {
+			if _, err := file.Seek(0, io.SeekStart); err == nil {
+				if head, err := mimetype.Head(file); err == nil {
+					part.MimeType = utils.StringPointer(mimetype.Detect(job.Name, head))
+				}
+			}
+		}
+
+		// the part is only recorded while the upload still exists
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			var jobs []models.UploadJob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", job.ID).
+				Where("status = ?", jobUploading).Find(&jobs).Error; err != nil {
+				return err
+			}
+			if len(jobs) == 0 {
+				return errJobCancelled
+			}
+			return tx.Create(part).Error
+		})
+	})
+}
+
+// removeStagedJobs drops the jobs of an upload together with their staged
+// data. Running jobs are marked cancelled, the worker running them stops and
+// drops them without recording the part.
+func removeStagedJobs(userId int64, uploadId string) error {
+	var jobs, running []models.UploadJob
+
+	if err := database.DB.Clauses(clause.Returning{}).Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Where("status in ?", []string{jobQueued, jobFailed, jobDone}).Delete(&jobs).Error; err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		os.Remove(job.Path)
+	}
+
+	if err := database.DB.Model(&running).Clauses(clause.Returning{}).Where("upload_id = ?", uploadId).
+		Where("user_id = ?", userId).Where("status = ?", jobUploading).
+		Updates(map[string]interface{}{"status": jobCancelled, "updated_at": time.Now().UTC()}).Error; err != nil {
+		return err
+	}
+
+	for _, job := range running {
+		if cancel, ok := ingestCancels.Load(job.ID); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	return nil
+}
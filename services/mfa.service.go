@@ -0,0 +1,366 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/secret"
+	"github.com/divyam234/teldrive/utils/totp"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer         = "Teldrive"
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrInvalidSecondFactor  = errors.New("invalid second factor code")
+)
+
+type MFAService struct {
+	Db *gorm.DB
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCodes() ([]string, models.RecoveryCodes, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make(models.RecoveryCodes, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(buf)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func getUserMFA(db *gorm.DB, userID int64) (*models.UserMFA, error) {
+	var res []models.UserMFA
+	if err := db.Where("user_id = ?", userID).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return &res[0], nil
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+// The step of the last accepted TOTP code is stored so a captured code, or an
+// older one, cannot be replayed. Recovery codes are removed once used.
+func verifySecondFactor(db *gorm.DB, mfa *models.UserMFA, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, nil
+	}
+
+	plain, err := secret.Decrypt(mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.ValidateStep(plain, code, time.Now()); ok {
+		res := db.Model(&models.UserMFA{}).Where("user_id = ?", mfa.UserID).
+			Where("last_step < ?", step).Update("last_step", step)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		mfa.LastStep = step
+		return res.RowsAffected == 1, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range mfa.RecoveryCodes {
+		if h != hash {
+			continue
+		}
+		remaining := append(models.RecoveryCodes{}, mfa.RecoveryCodes[:i]...)
+		remaining = append(remaining, mfa.RecoveryCodes[i+1:]...)
+		res := db.Model(&models.UserMFA{}).Where("user_id = ?", mfa.UserID).
+			Where("recovery_codes @> ?::jsonb", fmt.Sprintf("[%q]", hash)).
+			Update("recovery_codes", remaining)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		mfa.RecoveryCodes = remaining
+		return res.RowsAffected == 1, nil
+	}
+	return false, nil
+}
+
+// checkSecondFactor is enforced after the Telegram login step. A ticket issued
+// by the websocket login after a successful check is accepted once in place
+// of a code.
+func checkSecondFactor(userID int64, code, ticket string) error {
+	mfa, err := getUserMFA(database.DB, userID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return nil
+	}
+	if ticket != "" && redeemMFATicket(ticket, userID) {
+		return nil
+	}
+	if code == "" {
+		return ErrSecondFactorRequired
+	}
+	ok, err := verifySecondFactor(database.DB, mfa, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+func mfaEnabled(userID int64) (bool, error) {
+	mfa, err := getUserMFA(database.DB, userID)
+	if err != nil {
+		return false, err
+	}
+	return mfa != nil && mfa.Enabled, nil
+}
+
+func issueMFATicket(userID int64) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(buf)
+	if err := cache.GetCache().Set(fmt.Sprintf("mfaticket:%s", ticket), userID, 300); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+func redeemMFATicket(ticket string, userID int64) bool {
+	var owner int64
+	key := fmt.Sprintf("mfaticket:%s", ticket)
+	if err := cache.GetCache().Get(key, &owner); err != nil {
+		return false
+	}
+	cache.GetCache().Delete(key)
+	return owner == userID
+}
+
+func (ms *MFAService) checkManage(c *gin.Context) *types.AppError {
+	if _, ok := c.Get("apiToken"); ok {
+		return &types.AppError{Error: errors.New("api tokens cannot manage two factor auth"), Code: http.StatusForbidden}
+	}
+	if authLocked(c.ClientIP()) {
+		return &types.AppError{Error: errors.New("too many failed attempts, try again later"), Code: http.StatusTooManyRequests}
+	}
+	return nil
+}
+
+// verifyCode checks the code sent with a management request against the
+// current enrollment.
+func (ms *MFAService) verifyCode(c *gin.Context, mfa *models.UserMFA) *types.AppError {
+	var payload schemas.MFACodeIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	ok, err := verifySecondFactor(ms.Db, mfa, payload.Code)
+
+	if err != nil {
+		return &types.AppError{Error: errors.New("failed to verify code"), Code: http.StatusInternalServerError}
+	}
+
+	if !ok {
+		recordAuthFailure(c.ClientIP())
+		return &types.AppError{Error: ErrInvalidSecondFactor, Code: http.StatusUnauthorized}
+	}
+	clearAuthFailures(c.ClientIP())
+	return nil
+}
+
+func (ms *MFAService) Status(c *gin.Context) (*schemas.MFAStatus, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	mfa, err := getUserMFA(ms.Db, userId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch two factor status"), Code: http.StatusInternalServerError}
+	}
+
+	if mfa == nil || !mfa.Enabled {
+		return &schemas.MFAStatus{}, nil
+	}
+
+	return &schemas.MFAStatus{Enabled: true, RecoveryCodesLeft: len(mfa.RecoveryCodes), EnabledAt: mfa.EnabledAt}, nil
+}
+
+func (ms *MFAService) Setup(c *gin.Context) (*schemas.MFASetup, *types.AppError) {
+	if appErr := ms.checkManage(c); appErr != nil {
+		return nil, appErr
+	}
+
+	val, _ := c.Get("jwtUser")
+	jwtUser := val.(*types.JWTClaims)
+	userId, _ := getUserAuth(c)
+
+	mfa, err := getUserMFA(ms.Db, userId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch two factor status"), Code: http.StatusInternalServerError}
+	}
+
+	if mfa != nil && mfa.Enabled {
+		return nil, &types.AppError{Error: errors.New("two factor auth already enabled"), Code: http.StatusConflict}
+	}
+
+	plain, err := totp.GenerateSecret()
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	sealed, err := secret.Encrypt(plain)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to encrypt secret"), Code: http.StatusInternalServerError}
+	}
+
+	if err := ms.Db.Save(&models.UserMFA{UserID: userId, Secret: sealed, CreatedAt: time.Now().UTC()}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to save two factor secret"), Code: http.StatusInternalServerError}
+	}
+
+	account := jwtUser.UserName
+	if account == "" {
+		account = strconv.FormatInt(userId, 10)
+	}
+
+	return &schemas.MFASetup{Secret: plain, URI: totp.URI(mfaIssuer, account, plain)}, nil
+}
+
+func (ms *MFAService) Enable(c *gin.Context) (*schemas.MFARecoveryCodes, *types.AppError) {
+	if appErr := ms.checkManage(c); appErr != nil {
+		return nil, appErr
+	}
+
+	userId, _ := getUserAuth(c)
+
+	mfa, err := getUserMFA(ms.Db, userId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch two factor status"), Code: http.StatusInternalServerError}
+	}
+
+	if mfa == nil {
+		return nil, &types.AppError{Error: errors.New("two factor auth not set up"), Code: http.StatusNotFound}
+	}
+
+	if mfa.Enabled {
+		return nil, &types.AppError{Error: errors.New("two factor auth already enabled"), Code: http.StatusConflict}
+	}
+
+	if appErr := ms.verifyCode(c, mfa); appErr != nil {
+		return nil, appErr
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	now := time.Now().UTC()
+
+	if err := ms.Db.Model(&models.UserMFA{}).Where("user_id = ?", userId).
+		Updates(map[string]interface{}{"enabled": true, "enabled_at": now, "recovery_codes": hashes}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to enable two factor auth"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (ms *MFAService) Disable(c *gin.Context) (*schemas.Message, *types.AppError) {
+	if appErr := ms.checkManage(c); appErr != nil {
+		return nil, appErr
+	}
+
+	userId, _ := getUserAuth(c)
+
+	mfa, err := getUserMFA(ms.Db, userId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch two factor status"), Code: http.StatusInternalServerError}
+	}
+
+	if mfa == nil || !mfa.Enabled {
+		return nil, &types.AppError{Error: errors.New("two factor auth not enabled"), Code: http.StatusNotFound}
+	}
+
+	if appErr := ms.verifyCode(c, mfa); appErr != nil {
+		return nil, appErr
+	}
+
+	if err := ms.Db.Where("user_id = ?", userId).Delete(&models.UserMFA{}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to disable two factor auth"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.Message{Status: true, Message: "two factor auth disabled"}, nil
+}
+
+func (ms *MFAService) RegenerateRecoveryCodes(c *gin.Context) (*schemas.MFARecoveryCodes, *types.AppError) {
+	if appErr := ms.checkManage(c); appErr != nil {
+		return nil, appErr
+	}
+
+	userId, _ := getUserAuth(c)
+
+	mfa, err := getUserMFA(ms.Db, userId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch two factor status"), Code: http.StatusInternalServerError}
+	}
+
+	if mfa == nil || !mfa.Enabled {
+		return nil, &types.AppError{Error: errors.New("two factor auth not enabled"), Code: http.StatusNotFound}
+	}
+
+	if appErr := ms.verifyCode(c, mfa); appErr != nil {
+		return nil, appErr
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	if err := ms.Db.Model(&models.UserMFA{}).Where("user_id = ?", userId).
+		Update("recovery_codes", hashes).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to save recovery codes"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/mimetype"
+	"github.com/divyam234/teldrive/utils/tgc"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// mimeBackfillBatch is how many files are loaded from the db at a time.
+const mimeBackfillBatch = 100
+
+// mimeHeadLimit is the smallest chunk Telegram serves from the start of a
+// document, it covers mimetype.SniffLen.
+const mimeHeadLimit = 4096
+
+var mimeBackfillRunning atomic.Bool
+
+// BackfillMimeTypes detects the type of existing files in the background by
+// reading the first chunk of each file. Only files without a specific type
+// are looked at unless all=true.
+func (as *AdminService) BackfillMimeTypes(c *gin.Context) (*schemas.Message, *types.AppError) {
+	all := c.Query("all") == "true"
+
+	if !mimeBackfillRunning.CompareAndSwap(false, true) {
+		return nil, &types.AppError{Error: errors.New("mime type backfill already running"), Code: http.StatusConflict}
+	}
+
+	go func() {
+		defer mimeBackfillRunning.Store(false)
+		runMimeBackfill(context.Background(), all)
+	}()
+
+	return &schemas.Message{Status: true, Message: "mime type backfill started"}, nil
+}
+
+func runMimeBackfill(ctx context.Context, all bool) {
+	var (
+		lastId  string
+		checked int
+		updated int
+	)
+
+	for {
+		var files []models.File
+
+		query := database.DB.Where("type = ?", "file").Where("status = ?", "active").
+			Where("id > ?", lastId).Order("id").Limit(mimeBackfillBatch)
+
+		if !all {
+			query = query.Where("mime_type in ?", []string{"", mimetype.Default})
+		}
+
+		if err := query.Find(&files).Error; err != nil {
+			utils.Logger.Error("mime type backfill failed", zap.Error(err))
+			return
+		}
+
+		if len(files) == 0 {
+			break
+		}
+
+		lastId = files[len(files)-1].ID
+
+		byUser := make(map[int64][]models.File)
+
+		for _, file := range files {
+			if file.Parts == nil || len(*file.Parts) == 0 || file.ChannelID == nil {
+				continue
+			}
+			byUser[file.UserID] = append(byUser[file.UserID], file)
+		}
+
+		for userId, userFiles := range byUser {
+			checked += len(userFiles)
+			updated += backfillUserMimeTypes(ctx, userId, userFiles)
+		}
+	}
+
+	utils.Logger.Info("mime type backfill finished", zap.Int("checked", checked), zap.Int("updated", updated))
+}
+
+func backfillUserMimeTypes(ctx context.Context, userId int64, files []models.File) int {
+	session, err := GetLatestSession(userId)
+
+	if err != nil {
+		return 0
+	}
+
+	client, err := tgc.UserLogin(ctx, session.Session)
+
+	if err != nil {
+		utils.Logger.Warn("mime type backfill skipped user", zap.Int64("user", userId), zap.Error(err))
+		return 0
+	}
+
+	updated := 0
+
+	tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		channelUser := strconv.FormatInt(userId, 10)
+		for _, file := range files {
+			head, err := readFileHead(ctx, client, file, channelUser)
+			if err != nil {
+				utils.Logger.Warn("mime type backfill skipped file", zap.String("file", file.ID), zap.Error(err))
+				continue
+			}
+			detected := mimetype.Detect(file.Name, head)
+			if detected == file.MimeType {
+				continue
+			}
+			if err := database.DB.Model(&models.File{}).Where("id = ?", file.ID).
+				Update("mime_type", detected).Error; err != nil {
+				continue
+			}
+			cache.GetCache().Delete(fmt.Sprintf("files:%s", file.ID))
+			updated++
+		}
+		return nil
+	})
+
+	return updated
+}
+
+// readFileHead downloads the first chunk of the first part of a file.
+func readFileHead(ctx context.Context, client *telegram.Client, file models.File, channelUser string) ([]byte, error) {
+	messages, err := getTGMessages(ctx, client, (*file.Parts)[:1], *file.ChannelID, channelUser)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages.Messages) == 0 {
+		return nil, errors.New("part message not found")
+	}
+
+	item, ok := messages.Messages[0].(*tg.Message)
+	if !ok {
+		return nil, errors.New("part message not found")
+	}
+
+	media, ok := item.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, errors.New("part message has no document")
+	}
+
+	document, ok := media.Document.(*tg.Document)
+	if !ok {
+		return nil, errors.New("part message has no document")
+	}
+
+	res, err := client.API().UploadGetFile(ctx, &tg.UploadGetFileRequest{
+		Location: document.AsInputDocumentFileLocation(),
+		Offset:   0,
+		Limit:    mimeHeadLimit,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	chunk, ok := res.(*tg.UploadFile)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", res)
+	}
+
+	return chunk.Bytes, nil
+}
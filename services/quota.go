@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/cache"
+)
+
+// Quota limits of a user, zero means unlimited.
+type Quota struct {
+	Bytes int64
+	Files int64
+}
+
+// GetUserQuota returns the per-user override when set and the configured
+// default otherwise.
+func GetUserQuota(userID int64) Quota {
+	var quota Quota
+
+	key := fmt.Sprintf("users:quota:%d", userID)
+
+	if err := cache.GetCache().Get(key, &quota); err == nil {
+		return quota
+	}
+
+	config := utils.GetConfig()
+
+	quota = Quota{Bytes: config.QuotaBytes, Files: config.QuotaFiles}
+
+	var user models.User
+
+	if err := database.DB.Model(&models.User{}).Select("quota_bytes", "quota_files").
+		Where("user_id = ?", userID).First(&user).Error; err == nil {
+		if user.QuotaBytes != nil {
+			quota.Bytes = *user.QuotaBytes
+		}
+		if user.QuotaFiles != nil {
+			quota.Files = *user.QuotaFiles
+		}
+	}
+
+	cache.GetCache().Set(key, &quota, 60)
+
+	return quota
+}
+
+// getUsage sums the stored files of a user. With withPending upload parts
+// and staged jobs count as well, except for those of excludeUpload.
+func getUsage(userID int64, withPending bool, excludeUpload string) (int64, int64, error) {
+	var usage struct {
+		Bytes int64
+		Files int64
+	}
+
+	if err := database.DB.Raw(`select coalesce(sum(size), 0) as bytes, count(*) as files from teldrive.files
+	where user_id = ? and type = 'file' and status = 'active'`, userID).Scan(&usage).Error; err != nil {
+		return 0, 0, err
+	}
+
+	if withPending {
+		var pending int64
+		if err := database.DB.Model(&models.Upload{}).Select("coalesce(sum(size), 0)").
+			Where("user_id = ?", userID).Where("upload_id != ?", excludeUpload).Scan(&pending).Error; err != nil {
+			return 0, 0, err
+		}
+		usage.Bytes += pending
+
+		var staged int64
+		if err := database.DB.Model(&models.UploadJob{}).Select("coalesce(sum(size), 0)").
+			Where("user_id = ?", userID).Where("status in ?", []string{jobQueued, jobUploading}).
+			Where("upload_id != ?", excludeUpload).Scan(&staged).Error; err != nil {
+			return 0, 0, err
+		}
+		usage.Bytes += staged
+	}
+
+	return usage.Bytes, usage.Files, nil
+}
+
+// checkQuota verifies that adding bytes and files keeps the user within quota.
+// Upload parts not yet turned into files count against the byte quota when
+// withPending is set.
+func checkQuota(userID, bytes, files int64, withPending bool) *types.AppError {
+	return checkUsage(userID, bytes, files, withPending, "")
+}
+
+// checkUploadQuota verifies that an upload of bytes in total fits the quota.
+// Parts it already stored are part of bytes and not counted as pending.
+func checkUploadQuota(userID int64, uploadID string, bytes int64) *types.AppError {
+	return checkUsage(userID, bytes, 0, true, uploadID)
+}
+
+func checkUsage(userID, bytes, files int64, withPending bool, excludeUpload string) *types.AppError {
+	quota := GetUserQuota(userID)
+
+	if quota.Bytes == 0 && quota.Files == 0 {
+		return nil
+	}
+
+	usedBytes, usedFiles, err := getUsage(userID, withPending, excludeUpload)
+
+	if err != nil {
+		return &types.AppError{Error: errors.New("failed to check quota"), Code: http.StatusInternalServerError}
+	}
+
+	if quota.Bytes > 0 && usedBytes+bytes > quota.Bytes {
+		return &types.AppError{Error: errors.New("storage quota exceeded"), Code: http.StatusInsufficientStorage}
+	}
+
+	if quota.Files > 0 && usedFiles+files > quota.Files {
+		return &types.AppError{Error: errors.New("file count quota exceeded"), Code: http.StatusInsufficientStorage}
+	}
+
+	return nil
+}
+
+func matchMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mimeType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchExtension(extensions []string, ext string) bool {
+	for _, item := range extensions {
+		if strings.TrimPrefix(strings.ToLower(strings.TrimSpace(item)), ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUploadPolicy applies the configured size, mime type and extension
+// rules. An empty mime type is derived from the file extension.
+func checkUploadPolicy(name, mimeType string, size int64) *types.AppError {
+	config := utils.GetConfig()
+
+	if config.MaxFileSize > 0 && size > config.MaxFileSize {
+		return &types.AppError{Error: fmt.Errorf("file exceeds maximum size of %d bytes", config.MaxFileSize),
+			Code: http.StatusRequestEntityTooLarge}
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+
+	if matchExtension(config.BlockedExtensions, ext) ||
+		(len(config.AllowedExtensions) > 0 && !matchExtension(config.AllowedExtensions, ext)) {
+		return &types.AppError{Error: fmt.Errorf("file extension %q not allowed", ext), Code: http.StatusUnsupportedMediaType}
+	}
+
+	if mimeType == "" && ext != "" {
+		mimeType = mime.TypeByExtension("." + ext)
+	}
+
+	mimeType, _, _ = strings.Cut(strings.ToLower(mimeType), ";")
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	if matchMimeType(config.BlockedMimeTypes, mimeType) ||
+		(len(config.AllowedMimeTypes) > 0 && !matchMimeType(config.AllowedMimeTypes, mimeType)) {
+		return &types.AppError{Error: fmt.Errorf("mime type %q not allowed", mimeType), Code: http.StatusUnsupportedMediaType}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/mapper"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const apiTokenPrefix = "tdk_"
+
+var validScopes = map[string]bool{
+	types.ScopeRead:   true,
+	types.ScopeUpload: true,
+	types.ScopeWrite:  true,
+}
+
+type TokenService struct {
+	Db *gorm.DB
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + hex.EncodeToString(buf), nil
+}
+
+func (ts *TokenService) CreateToken(c *gin.Context) (*schemas.APITokenCreated, *types.AppError) {
+	if _, ok := c.Get("apiToken"); ok {
+		return nil, &types.AppError{Error: errors.New("api tokens cannot manage tokens"), Code: http.StatusForbidden}
+	}
+
+	userId, _ := getUserAuth(c)
+
+	var payload schemas.APITokenIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+
+	if payload.Name == "" {
+		return nil, &types.AppError{Error: errors.New("token name missing"), Code: http.StatusBadRequest}
+	}
+
+	if len(payload.Scopes) == 0 {
+		return nil, &types.AppError{Error: errors.New("at least one scope is required"), Code: http.StatusBadRequest}
+	}
+
+	for _, scope := range payload.Scopes {
+		if !validScopes[scope] {
+			return nil, &types.AppError{Error: fmt.Errorf("invalid scope %s", scope), Code: http.StatusBadRequest}
+		}
+	}
+
+	if payload.Path != "" {
+		payload.Path = "/" + strings.Trim(strings.TrimSpace(payload.Path), "/")
+	}
+
+	token, err := generateAPIToken()
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to generate token"), Code: http.StatusInternalServerError}
+	}
+
+	apiToken := &models.APIToken{
+		UserID:    userId,
+		Name:      payload.Name,
+		TokenHash: HashAPIToken(token),
+		Scopes:    payload.Scopes,
+		Path:      payload.Path,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := ts.Db.Create(apiToken).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create token"), Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.APITokenCreated{APITokenOut: *mapper.MapAPITokenSchema(apiToken), Token: token}, nil
+}
+
+func (ts *TokenService) ListTokens(c *gin.Context) ([]schemas.APITokenOut, *types.AppError) {
+	userId, _ := getUserAuth(c)
+
+	var tokens []models.APIToken
+
+	if err := ts.Db.Model(&models.APIToken{}).Where("user_id = ?", userId).
+		Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch tokens"), Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.APITokenOut{}
+
+	for _, token := range tokens {
+		res = append(res, *mapper.MapAPITokenSchema(&token))
+	}
+
+	return res, nil
+}
+
+func (ts *TokenService) RevokeToken(c *gin.Context) (*schemas.Message, *types.AppError) {
+	if _, ok := c.Get("apiToken"); ok {
+		return nil, &types.AppError{Error: errors.New("api tokens cannot manage tokens"), Code: http.StatusForbidden}
+	}
+
+	userId, _ := getUserAuth(c)
+
+	var tokens []models.APIToken
+
+	if err := ts.Db.Model(&tokens).Clauses(clause.Returning{}).Where("id = ?", c.Param("id")).
+		Where("user_id = ?", userId).Update("revoked", true).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to revoke token"), Code: http.StatusInternalServerError}
+	}
+
+	if len(tokens) == 0 {
+		return nil, &types.AppError{Error: errors.New("token not found"), Code: http.StatusNotFound}
+	}
+
+	cache.GetCache().Delete(fmt.Sprintf("apitokens:%s", tokens[0].TokenHash))
+
+	return &schemas.Message{Status: true, Message: "token revoked"}, nil
+}
+
+// TouchAPIToken records token usage at most once a minute to keep the
+// hot path free of writes.
+func TouchAPIToken(token *models.APIToken) {
+	now := time.Now().UTC()
+
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < time.Minute {
+		return
+	}
+
+	token.LastUsedAt = &now
+
+	if err := database.DB.Model(&models.APIToken{}).Where("id = ?", token.ID).
+		UpdateColumn("last_used_at", now).Error; err != nil {
+		return
+	}
+
+	cache.GetCache().Set(fmt.Sprintf("apitokens:%s", token.TokenHash), token, 300)
+}
@@ -3,14 +3,22 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/divyam234/teldrive/mapper"
 	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/events"
+	"github.com/divyam234/teldrive/utils/mimetype"
 	"github.com/divyam234/teldrive/utils/tgc"
 
 	"github.com/divyam234/teldrive/types"
@@ -21,6 +29,7 @@ import (
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
 )
 
@@ -42,8 +51,13 @@ func (us *UploadService) GetUploadFileById(c *gin.Context) (*schemas.UploadOut,
 }
 
 func (us *UploadService) DeleteUploadFile(c *gin.Context) *types.AppError {
+	userId, _ := getUserAuth(c)
 	uploadId := c.Param("id")
-	if err := us.Db.Where("upload_id = ?", uploadId).Delete(&models.Upload{}).Error; err != nil {
+	if err := us.Db.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).Delete(&models.Upload{}).Error; err != nil {
+		return &types.AppError{Error: errors.New("failed to delete upload"), Code: http.StatusInternalServerError}
+	}
+
+	if err := removeStagedJobs(userId, uploadId); err != nil {
 		return &types.AppError{Error: errors.New("failed to delete upload"), Code: http.StatusInternalServerError}
 	}
 
@@ -107,12 +121,23 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 
 	uploadId := c.Param("id")
 
-	file := c.Request.Body
-
 	fileSize := c.Request.ContentLength
 
 	fileName := uploadQuery.Filename
 
+	sniffer := mimetype.NewReader(c.Request.Body)
+
+	file := events.NewReader(sniffer, userId, events.Event{Type: events.TypeUpload, ID: uploadId,
+		PartNo: uploadQuery.PartNo, Name: fileName, Total: fileSize})
+
+	if err := checkUploadPolicy(fileName, "", fileSize); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(userId, fileSize, 0, true); err != nil {
+		return nil, err
+	}
+
 	if uploadQuery.ChannelID == 0 {
 		channelId, err = GetDefaultChannel(c, userId)
 		if err != nil {
@@ -129,11 +154,17 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 	}
 
 	if len(tokens) == 0 {
-		client, _ = tgc.UserLogin(c, session)
+		client, err = tgc.UserLogin(c, session)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		}
 		channelUser = strconv.FormatInt(userId, 10)
 	} else {
 		tgc.Workers.Set(tokens, channelId)
-		token = tgc.Workers.Next(channelId)
+		token, err = tgc.Workers.Next(channelId)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusServiceUnavailable}
+		}
 		client, _ = tgc.BotLogin(c, token)
 		channelUser = strings.Split(token, ":")[0]
 	}
@@ -146,69 +177,657 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 			return err
 		}
 
-		api := client.API()
+		tuningKey := uploadTuningKey(token, userId)
 
-		u := uploader.NewUploader(api).WithThreads(16).WithPartSize(512 * 1024)
+		params := tgc.UploadTuner.Params(tuningKey, uploadQuery.Threads, uploadQuery.PartSize, fileSize)
 
-		upload, err := u.Upload(c, uploader.NewUpload(fileName, file, fileSize))
+		messageID, stats, err := sendDocument(ctx, client, channel, fileName, file, fileSize, params)
+
+		tgc.UploadTuner.Observe(tuningKey, params, stats)
 
 		if err != nil {
 			return err
 		}
 
-		document := message.UploadedDocument(upload).Filename(fileName).ForceFile(true)
+		partUpload := &models.Upload{
+			Name:       fileName,
+			UploadId:   uploadId,
+			PartId:     messageID,
+			ChannelID:  channelId,
+			Size:       fileSize,
+			PartNo:     uploadQuery.PartNo,
+			TotalParts: uploadQuery.TotalParts,
+			UserId:     userId,
+		}
+
+		if uploadQuery.PartNo == 1 {
+			partUpload.MimeType = utils.StringPointer(mimetype.Detect(fileName, sniffer.Head()))
+		}
+
+		if err := us.Db.Create(partUpload).Error; err != nil {
+			return errors.New("failed to upload part")
+		}
+
+		out = mapper.MapUploadSchema(partUpload)
+
+		out.Tuning = mapUploadTuning(params, stats)
+
+		return nil
+	})
+
+	file.Finish(err)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	return out, nil
+}
 
-		sender := message.NewSender(client.API())
+// CompleteUpload turns the parts of an upload into a file. All parts
+// 1..total_parts must be present with consistent sizes and their messages
+// must still exist in the channel. The file is created and the upload rows
+// are removed in one transaction.
+func (us *UploadService) CompleteUpload(c *gin.Context) (*schemas.FileOut, *types.AppError) {
+	var payload schemas.UploadComplete
 
-		target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
-			AccessHash: channel.AccessHash})
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid request payload"), Code: http.StatusBadRequest}
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+
+	if payload.Name == "" {
+		return nil, &types.AppError{Error: errors.New("file name missing"), Code: http.StatusBadRequest}
+	}
+
+	userId, session := getUserAuth(c)
+
+	uploadId := c.Param("id")
+
+	var pendingJobs int64
+
+	if err := us.Db.Model(&models.UploadJob{}).Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Where("status in ?", []string{jobQueued, jobUploading}).Count(&pendingJobs).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if pendingJobs > 0 {
+		return nil, &types.AppError{Error: errors.New("upload still in progress"), Code: http.StatusConflict}
+	}
 
-		res, err := target.Media(c, document)
+	var parts []models.Upload
+
+	if err := us.Db.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Order("part_no").Find(&parts).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if len(parts) == 0 {
+		return nil, &types.AppError{Error: errors.New("upload not found"), Code: http.StatusNotFound}
+	}
+
+	if err := validateUploadParts(parts); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusConflict}
+	}
+
+	channelId := parts[0].ChannelID
+
+	if err := verifyUploadMessages(c, userId, session, channelId, parts); err != nil {
+		return nil, err
+	}
+
+	var size int64
+
+	fileParts := models.Parts{}
+
+	for _, part := range parts {
+		size += part.Size
+		fileParts = append(fileParts, models.Part{ID: int64(part.PartId)})
+	}
+
+	mimeType := payload.MimeType
+
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(payload.Name))
+	}
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	fileIn := schemas.FileIn{
+		Name:      payload.Name,
+		Type:      "file",
+		Parts:     &fileParts,
+		MimeType:  mimeType,
+		ChannelID: channelId,
+		Path:      payload.Path,
+		ParentID:  payload.ParentID,
+		Size:      size,
+	}
+
+	policy, appErr := parseConflictPolicy(payload.Conflict)
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := prepareFileIn(c, us.Db, &fileIn, userId); err != nil {
+		return nil, err
+	}
+
+	var (
+		fileDb  *models.File
+		outcome string
+	)
+
+	err := us.Db.Transaction(func(tx *gorm.DB) error {
+		fileDb, outcome, appErr = createFile(tx, &fileIn, policy)
+		if appErr != nil {
+			return appErr.Error
+		}
+		// skipped parts stay until UPLOAD_RETENTION removes their messages
+		if outcome == OutcomeSkipped {
+			return nil
+		}
+		if err := tx.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).Delete(&models.Upload{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).Where("status = ?", jobDone).
+			Delete(&models.UploadJob{}).Error
+	})
+
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to create a file"), Code: http.StatusInternalServerError}
+	}
+
+	res := mapper.MapFileToFileOut(*fileDb)
+
+	res.Outcome = outcome
+
+	return &res, nil
+}
+
+func validateUploadParts(parts []models.Upload) error {
+	totalParts := parts[0].TotalParts
+
+	if len(parts) != totalParts {
+		return fmt.Errorf("expected %d parts, found %d", totalParts, len(parts))
+	}
+
+	for i, part := range parts {
+		switch {
+		case part.PartNo != i+1:
+			return fmt.Errorf("part %d missing or duplicated", i+1)
+		case part.TotalParts != totalParts:
+			return fmt.Errorf("part %d has inconsistent total parts", part.PartNo)
+		case part.ChannelID != parts[0].ChannelID:
+			return fmt.Errorf("part %d is in another channel", part.PartNo)
+		case part.Size <= 0:
+			return fmt.Errorf("part %d is empty", part.PartNo)
+		case i < totalParts-1 && part.Size != parts[0].Size:
+			return fmt.Errorf("part %d has inconsistent size", part.PartNo)
+		case i == totalParts-1 && part.Size > parts[0].Size:
+			return fmt.Errorf("last part is larger than the others")
+		}
+	}
+
+	return nil
+}
+
+// verifyUploadMessages checks that every part message still exists in the
+// channel and holds a document of the recorded size.
+func verifyUploadMessages(c *gin.Context, userId int64, session string, channelId int64, parts []models.Upload) *types.AppError {
+	tokens, err := GetBotsToken(c, userId, channelId)
+
+	if err != nil {
+		return &types.AppError{Error: errors.New("failed to fetch bots"), Code: http.StatusInternalServerError}
+	}
+
+	var (
+		client      *telegram.Client
+		token       string
+		channelUser string
+	)
+
+	if len(tokens) == 0 {
+		client, err = tgc.UserLogin(c, session)
+		if err != nil {
+			return &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		}
+		channelUser = strconv.FormatInt(userId, 10)
+	} else {
+		tgc.Workers.Set(tokens, channelId)
+		token, err = tgc.Workers.Next(channelId)
+		if err != nil {
+			return &types.AppError{Error: err, Code: http.StatusServiceUnavailable}
+		}
+		client, _ = tgc.BotLogin(c, token)
+		channelUser = strings.Split(token, ":")[0]
+	}
+
+	fileParts := models.Parts{}
+
+	for _, part := range parts {
+		fileParts = append(fileParts, models.Part{ID: int64(part.PartId)})
+	}
+
+	var invalid error
+
+	err = tgc.RunWithAuth(c, client, token, func(ctx context.Context) error {
+		messages, err := getTGMessages(ctx, client, fileParts, channelId, channelUser)
 
 		if err != nil {
 			return err
 		}
 
-		updates := res.(*tg.Updates)
+		sizes := make(map[int]int64)
 
-		var message *tg.Message
+		for _, msg := range messages.Messages {
+			item, ok := msg.(*tg.Message)
+			if !ok {
+				continue
+			}
+			media, ok := item.Media.(*tg.MessageMediaDocument)
+			if !ok {
+				continue
+			}
+			if document, ok := media.Document.(*tg.Document); ok {
+				sizes[item.ID] = document.Size
+			}
+		}
 
-		for _, update := range updates.Updates {
-			channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
-			if ok {
-				message = channelMsg.Message.(*tg.Message)
-				break
+		for _, part := range parts {
+			size, ok := sizes[part.PartId]
+			if !ok {
+				invalid = fmt.Errorf("message of part %d not found", part.PartNo)
+				return nil
 			}
+			if size != part.Size {
+				invalid = fmt.Errorf("part %d size mismatch", part.PartNo)
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	if invalid != nil {
+		return &types.AppError{Error: invalid, Code: http.StatusConflict}
+	}
+
+	return nil
+}
+
+// maxSplitSize keeps every part below the 2 GB Telegram file limit.
+const maxSplitSize = 2000 * 1024 * 1024
+
+// UploadFileParallel splits the request body into parts of splitSize and
+// uploads them concurrently, each part with the least loaded bot of the
+// channel. Every part is buffered to a temporary file so a failed attempt
+// can be retried with another bot. Parts already uploaded under the same
+// upload id are skipped, so an interrupted upload can be sent again.
+func (us *UploadService) UploadFileParallel(c *gin.Context) (*schemas.UploadOut, *types.AppError) {
 
+	var (
+		uploadQuery schemas.UploadQuery
+		channelId   int64
+		err         error
+	)
+
+	if err := c.ShouldBindQuery(&uploadQuery); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if uploadQuery.Filename == "" {
+		return nil, &types.AppError{Error: errors.New("filename missing"), Code: http.StatusBadRequest}
+	}
+
+	userId, session := getUserAuth(c)
+
+	uploadId := c.Param("id")
+
+	fileName := uploadQuery.Filename
+
+	// A body without content length (chunked transfer) is cut into parts as
+	// it arrives, its size is only known once it ends.
+	fileSize := c.Request.ContentLength
+
+	if fileSize == 0 {
+		return nil, &types.AppError{Error: errors.New("empty body"), Code: http.StatusBadRequest}
+	}
+
+	if err := checkUploadPolicy(fileName, "", utils.Max(fileSize, 0)); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(userId, utils.Max(fileSize, 0), 0, true); err != nil {
+		return nil, err
+	}
+
+	splitSize := uploadQuery.SplitSize
+	if splitSize <= 0 {
+		splitSize = utils.GetConfig().UploadSplitSize
+	}
+	splitSize = utils.Min(splitSize, maxSplitSize)
+
+	if uploadQuery.ChannelID == 0 {
+		channelId, err = GetDefaultChannel(c, userId)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
 		}
+	} else {
+		channelId = uploadQuery.ChannelID
+	}
 
-		if message.ID == 0 {
-			return errors.New("failed to upload part")
+	tokens, err := GetBotsToken(c, userId, channelId)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch bots"), Code: http.StatusInternalServerError}
+	}
+
+	// without bots the parts go one at a time through the user's session
+	if len(tokens) > 0 {
+		tgc.Workers.Set(tokens, channelId)
+		session = ""
+	}
+
+	totalParts := 0
+
+	if fileSize > 0 {
+		totalParts = int((fileSize + splitSize - 1) / splitSize)
+	}
+
+	var uploaded []int
+
+	if err := us.Db.Model(&models.Upload{}).Where("upload_id = ?", uploadId).
+		Where("user_id = ?", userId).Pluck("part_no", &uploaded).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	done := make(map[int]bool, len(uploaded))
+	for _, partNo := range uploaded {
+		done[partNo] = true
+	}
+
+	var mu sync.Mutex
+
+	tunings := make(map[int]*schemas.UploadTuning)
+
+	g, ctx := errgroup.WithContext(c)
+	g.SetLimit(utils.Max(len(tokens), 1))
+
+	var received int64
+
+	for partNo := 1; fileSize < 0 || partNo <= totalParts; partNo++ {
+		size := splitSize
+		if fileSize > 0 {
+			size = utils.Min(splitSize, fileSize-received)
 		}
 
-		partUpload := &models.Upload{
-			Name:       fileName,
+		var dst io.Writer = io.Discard
+
+		var tmp *os.File
+
+		if !done[partNo] {
+			tmp, err = os.CreateTemp("", "teldrive-upload-*")
+			if err != nil {
+				g.Wait()
+				return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+			}
+			dst = tmp
+		}
+
+		n, err := io.CopyN(dst, c.Request.Body, size)
+
+		if err == io.EOF && fileSize < 0 {
+			err = nil
+			size = n
+		}
+
+		if err != nil || size == 0 || ctx.Err() != nil {
+			if tmp != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+			}
+			if err != nil {
+				g.Wait()
+				return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+			}
+			break
+		}
+
+		received += size
+
+		if fileSize < 0 {
+			totalParts = partNo
+			appErr := checkUploadPolicy(fileName, "", received)
+			if appErr == nil {
+				appErr = checkUploadQuota(userId, uploadId, received)
+			}
+			if appErr != nil {
+				if tmp != nil {
+					tmp.Close()
+					os.Remove(tmp.Name())
+				}
+				g.Wait()
+				return nil, appErr
+			}
+		}
+
+		if tmp == nil {
+			continue
+		}
+
+		part := &models.Upload{
+			Name:       fmt.Sprintf("%s.part.%03d", fileName, partNo),
 			UploadId:   uploadId,
-			PartId:     message.ID,
 			ChannelID:  channelId,
-			Size:       fileSize,
-			PartNo:     uploadQuery.PartNo,
-			TotalParts: uploadQuery.TotalParts,
+			Size:       size,
+			PartNo:     partNo,
+			TotalParts: totalParts,
 			UserId:     userId,
 		}
 
-		if err := us.Db.Create(partUpload).Error; err != nil {
-			return errors.New("failed to upload part")
+		if partNo == 1 {
+			if _, err := tmp.Seek(0, io.SeekStart); err == nil {
+				if head, err := mimetype.Head(tmp); err == nil {
+					part.MimeType = utils.StringPointer(mimetype.Detect(fileName, head))
+				}
+			}
 		}
 
-		out = mapper.MapUploadSchema(partUpload)
+		g.Go(func() error {
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			tuning, err := us.uploadPartWithBots(ctx, channelId, session, tmp, part, &uploadQuery)
+			if err == nil {
+				mu.Lock()
+				tunings[part.PartNo] = tuning
+				mu.Unlock()
+			}
+			return err
+		})
+	}
 
-		return nil
-	})
+	if err := g.Wait(); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	if fileSize < 0 {
+		if totalParts == 0 {
+			return nil, &types.AppError{Error: errors.New("empty body"), Code: http.StatusBadRequest}
+		}
+		if err := us.Db.Model(&models.Upload{}).Where("upload_id = ?", uploadId).
+			Where("user_id = ?", userId).Update("total_parts", totalParts).Error; err != nil {
+			return nil, &types.AppError{Error: errors.New("failed to update upload"), Code: http.StatusInternalServerError}
+		}
+	}
+
+	parts := []schemas.UploadPartOut{}
+
+	if err := us.Db.Model(&models.Upload{}).Order("part_no").Where("upload_id = ?", uploadId).
+		Where("user_id = ?", userId).Find(&parts).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	var size int64
+
+	for i := range parts {
+		parts[i].Tuning = tunings[parts[i].PartNo]
+		size += parts[i].Size
+	}
+
+	return &schemas.UploadOut{Parts: parts, Size: size}, nil
+}
+
+// uploadPartWithBots uploads one buffered part, trying another bot of the
+// channel when an attempt fails. With a session the user's client is used
+// instead of bots.
+func (us *UploadService) uploadPartWithBots(ctx context.Context, channelId int64, session string, r io.ReadSeeker, part *models.Upload,
+	uploadQuery *schemas.UploadQuery) (*schemas.UploadTuning, error) {
+	var (
+		err      error
+		tuning   *schemas.UploadTuning
+		progress *events.Reader
+	)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var (
+			token       string
+			client      *telegram.Client
+			channelUser string
+		)
+
+		if session != "" {
+			client, err = tgc.UserLogin(ctx, session)
+			channelUser = strconv.FormatInt(part.UserId, 10)
+		} else {
+			token, err = tgc.Workers.Next(channelId)
+			if err == nil {
+				client, _ = tgc.BotLogin(ctx, token)
+				channelUser = strings.Split(token, ":")[0]
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		tuningKey := uploadTuningKey(token, part.UserId)
+
+		params := tgc.UploadTuner.Params(tuningKey, uploadQuery.Threads, uploadQuery.PartSize, part.Size)
+
+		progress = events.NewReader(r, part.UserId, events.Event{Type: events.TypeUpload, ID: part.UploadId,
+			PartNo: part.PartNo, Name: part.Name, Total: part.Size})
+
+		err = tgc.RunWithAuth(ctx, client, token, func(ctx context.Context) error {
+			channel, err := GetChannelById(ctx, client, channelId, channelUser)
+			if err != nil {
+				return err
+			}
+			var stats *tgc.UploadStats
+			part.PartId, stats, err = sendDocument(ctx, client, channel, part.Name, progress, part.Size, params)
+			tgc.UploadTuner.Observe(tuningKey, params, stats)
+			tuning = mapUploadTuning(params, stats)
+			return err
+		})
+
+		if err == nil {
+			if err := us.Db.Create(part).Error; err != nil {
+				progress.Finish(err)
+				return nil, errors.New("failed to upload part")
+			}
+			progress.Finish(nil)
+			return tuning, nil
+		}
+	}
+	if progress != nil {
+		progress.Finish(err)
+	}
+	return nil, err
+}
+
+func uploadTuningKey(token string, userId int64) string {
+	if token == "" {
+		return fmt.Sprintf("user:%d", userId)
+	}
+	return fmt.Sprintf("bot:%d", tgc.BotID(token))
+}
+
+func mapUploadTuning(params tgc.UploadParams, stats *tgc.UploadStats) *schemas.UploadTuning {
+	return &schemas.UploadTuning{
+		Threads:      params.Threads,
+		PartSize:     params.PartSize,
+		Parts:        stats.Parts,
+		SlowParts:    stats.SlowParts,
+		FloodWaits:   stats.FloodWaits,
+		AvgLatencyMs: stats.AvgLatency.Milliseconds(),
+	}
+}
+
+// sendDocument uploads r as a document to the channel and returns the id of
+// the message holding it.
+func sendDocument(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, name string, r io.Reader, size int64,
+	params tgc.UploadParams) (int, *tgc.UploadStats, error) {
+	api := client.API()
+
+	observer := tgc.NewUploadObserver(api)
+
+	u := uploader.NewUploader(observer).WithThreads(params.Threads).WithPartSize(params.PartSize)
+
+	upload, err := u.Upload(ctx, uploader.NewUpload(name, r, size))
 
 	if err != nil {
-		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		return 0, observer.Stats(), err
 	}
 
-	return out, nil
+	document := message.UploadedDocument(upload).Filename(name).ForceFile(true)
+
+	sender := message.NewSender(api)
+
+	target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
+		AccessHash: channel.AccessHash})
+
+	res, err := target.Media(ctx, document)
+
+	if err != nil {
+		return 0, observer.Stats(), err
+	}
+
+	updates := res.(*tg.Updates)
+
+	var message *tg.Message
+
+	for _, update := range updates.Updates {
+		channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
+		if ok {
+			message = channelMsg.Message.(*tg.Message)
+			break
+		}
+
+	}
+
+	if message == nil || message.ID == 0 {
+		return 0, observer.Stats(), errors.New("failed to upload part")
+	}
+
+	return message.ID, observer.Stats(), nil
 }
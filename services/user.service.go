@@ -5,15 +5,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/divyam234/teldrive/database"
 	"github.com/divyam234/teldrive/models"
 	"github.com/divyam234/teldrive/schemas"
 	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
 	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/events"
+	"github.com/divyam234/teldrive/utils/secret"
 	"github.com/divyam234/teldrive/utils/tgc"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/message/peer"
@@ -86,7 +91,28 @@ func (us *UserService) Stats(c *gin.Context) (*schemas.AccountStats, *types.AppE
 	if err := us.Db.Raw("select * from teldrive.account_stats(?);", userId).Scan(&res).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to get stats"), Code: http.StatusInternalServerError}
 	}
-	return &res[0], nil
+
+	stats := &res[0]
+
+	quota := GetUserQuota(userId)
+
+	if quota.Bytes > 0 {
+		remaining := utils.Max(quota.Bytes-stats.TotalSize, 0)
+		stats.QuotaBytes = &quota.Bytes
+		stats.RemainingBytes = &remaining
+	}
+
+	if quota.Files > 0 {
+		remaining := utils.Max(quota.Files-stats.TotalFiles, 0)
+		stats.QuotaFiles = &quota.Files
+		stats.RemainingFiles = &remaining
+	}
+
+	if maxSize := utils.GetConfig().MaxFileSize; maxSize > 0 {
+		stats.MaxFileSize = &maxSize
+	}
+
+	return stats, nil
 }
 
 func (us *UserService) GetBots(c *gin.Context) ([]string, *types.AppError) {
@@ -112,6 +138,87 @@ func (us *UserService) GetBots(c *gin.Context) ([]string, *types.AppError) {
 	return tokens, nil
 }
 
+func (us *UserService) BotsHealth(c *gin.Context) ([]schemas.BotHealthOut, *types.AppError) {
+	userID, _ := getUserAuth(c)
+
+	channelId, err := GetDefaultChannel(c, userID)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	var bots []models.Bot
+
+	if err := us.Db.Model(&models.Bot{}).Where("user_id = ?", userID).
+		Where("channel_id = ?", channelId).Order("bot_id").Find(&bots).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to fetch bots"), Code: http.StatusInternalServerError}
+	}
+
+	botIDs := []int64{}
+	for _, bot := range bots {
+		botIDs = append(botIDs, bot.BotID)
+	}
+
+	res := []schemas.BotHealthOut{}
+
+	for i, state := range tgc.BotHealth.Snapshot(botIDs) {
+		out := schemas.BotHealthOut{
+			BotID:          state.BotID,
+			BotUserName:    bots[i].BotUserName,
+			State:          state.State,
+			InFlight:       state.InFlight,
+			Errors:         state.Errors,
+			Requests:       state.Requests,
+			FloodWaitUntil: state.FloodWaitUntil,
+			CooldownUntil:  state.CooldownUntil,
+			DisabledReason: state.DisabledReason,
+			LastError:      state.LastError,
+			LastErrorAt:    state.LastErrorAt,
+			AvgLatencyMs:   state.AvgLatency.Milliseconds(),
+			BytesPerSecond: int64(state.BytesPerSecond),
+		}
+		if bots[i].DisabledReason != nil {
+			out.State = tgc.BotDisabled
+			out.DisabledReason = *bots[i].DisabledReason
+		}
+		res = append(res, out)
+	}
+
+	return res, nil
+}
+
+// EnableBot puts a disabled bot back into the pool, e.g. after its token
+// was regenerated with BotFather and added again.
+func (us *UserService) EnableBot(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userID, _ := getUserAuth(c)
+
+	botID, err := strconv.ParseInt(c.Param("botID"), 10, 64)
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid bot id"), Code: http.StatusBadRequest}
+	}
+
+	var bots []models.Bot
+
+	if err := us.Db.Clauses(clause.Returning{}).Model(&bots).Where("user_id = ?", userID).
+		Where("bot_id = ?", botID).
+		Updates(map[string]interface{}{"disabled_reason": nil, "disabled_at": nil}).Error; err != nil {
+		return nil, &types.AppError{Error: errors.New("failed to enable bot"), Code: http.StatusInternalServerError}
+	}
+
+	if len(bots) == 0 {
+		return nil, &types.AppError{Error: errors.New("bot not found"), Code: http.StatusNotFound}
+	}
+
+	for _, bot := range bots {
+		cache.GetCache().Delete(fmt.Sprintf("users:bots:%d:%d", userID, bot.ChannelID))
+	}
+
+	tgc.BotHealth.Enable(botID)
+
+	return &schemas.Message{Status: true, Message: "bot enabled"}, nil
+}
+
 func (us *UserService) UpdateChannel(c *gin.Context) (*schemas.Message, *types.AppError) {
 	userId, _ := getUserAuth(c)
 
@@ -141,11 +248,15 @@ func (us *UserService) UpdateChannel(c *gin.Context) (*schemas.Message, *types.A
 
 func (us *UserService) ListChannels(c *gin.Context) (interface{}, *types.AppError) {
 	_, session := getUserAuth(c)
-	client, _ := tgc.UserLogin(c, session)
+	client, err := tgc.UserLogin(c, session)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
 
 	channels := make(map[int64]*schemas.Channel)
 
-	client.Run(c, func(ctx context.Context) error {
+	tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
 
 		dialogs, _ := query.GetDialogs(client.API()).BatchSize(100).Collect(ctx)
 
@@ -168,7 +279,11 @@ func (us *UserService) ListChannels(c *gin.Context) (interface{}, *types.AppErro
 
 func (us *UserService) AddBots(c *gin.Context) (*schemas.Message, *types.AppError) {
 	userId, session := getUserAuth(c)
-	client, _ := tgc.UserLogin(c, session)
+	client, err := tgc.UserLogin(c, session)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
 
 	var botsTokens []string
 
@@ -206,6 +321,9 @@ func (us *UserService) RemoveBots(c *gin.Context) (*schemas.Message, *types.AppE
 
 	cache.GetCache().Delete(fmt.Sprintf("users:bots:%d:%d", userID, channelId))
 
+	tgc.Workers.Drop(channelId)
+	tgc.StreamWorkers.Drop(channelId)
+
 	return &schemas.Message{Status: true, Message: "bots deleted"}, nil
 
 }
@@ -332,17 +450,54 @@ func (us *UserService) addBots(c context.Context, client *telegram.Client, userI
 	payload := []models.Bot{}
 
 	for _, info := range botInfo {
-		payload = append(payload, models.Bot{UserID: userId, Token: info.Token, BotID: info.Id,
+		token, err := secret.Encrypt(info.Token)
+		if err != nil {
+			return nil, &types.AppError{Error: errors.New("failed to encrypt bot token"), Code: http.StatusInternalServerError}
+		}
+		payload = append(payload, models.Bot{UserID: userId, Token: token, BotID: info.Id,
 			BotUserName: info.UserName, ChannelID: channelId,
 		})
 	}
 
 	cache.GetCache().Delete(fmt.Sprintf("users:bots:%d:%d", userId, channelId))
 
-	if err := us.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(&payload).Error; err != nil {
+	if err := us.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "bot_id"}, {Name: "channel_id"}},
+		DoNothing: true,
+	}).Create(&payload).Error; err != nil {
 		return nil, &types.AppError{Error: errors.New("failed to add bots"), Code: http.StatusInternalServerError}
 	}
 
 	return &schemas.Message{Status: true, Message: "bots added"}, nil
 
 }
+
+// Events streams the upload and job progress of the user as server-sent
+// events until the client goes away.
+func (us *UserService) Events(c *gin.Context) {
+	userId, _ := getUserAuth(c)
+
+	ch, unsubscribe := events.Bus.Subscribe(userId)
+
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(15 * time.Second)
+
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-ch:
+			c.SSEvent(event.Type, event)
+		case <-keepAlive.C:
+			io.WriteString(w, ": ping\n\n")
+		}
+		return true
+	})
+}
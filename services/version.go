@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/schemas"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errFileModified = errors.New("file has been modified")
+
+// FileETag formats the version of a file as an entity tag.
+func FileETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// ifMatchVersion reads the version from the If-Match header. It returns nil
+// when the header is missing or "*", unless STRICT_IF_MATCH requires it.
+func ifMatchVersion(c *gin.Context) (*int, *types.AppError) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+
+	if header == "" {
+		if utils.GetConfig().StrictIfMatch {
+			return nil, &types.AppError{Error: errors.New("If-Match header required"), Code: http.StatusPreconditionRequired}
+		}
+		return nil, nil
+	}
+
+	if header == "*" {
+		return nil, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), "\""))
+
+	if err != nil {
+		return nil, &types.AppError{Error: errors.New("invalid If-Match header"), Code: http.StatusBadRequest}
+	}
+
+	return &version, nil
+}
+
+// checkFileVersions locks the files for the rest of the transaction and
+// fails with 412 when one of them changed since the client read it.
+func checkFileVersions(tx *gorm.DB, versions map[string]int) *types.AppError {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(versions))
+
+	for id := range versions {
+		ids = append(ids, id)
+	}
+
+	var files []models.File
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "version").
+		Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return &types.AppError{Error: errors.New("failed to fetch from db"), Code: http.StatusInternalServerError}
+	}
+
+	if len(files) != len(ids) {
+		return &types.AppError{Error: errors.New("file not found"), Code: http.StatusNotFound}
+	}
+
+	for _, file := range files {
+		if versions[file.ID] != file.Version {
+			return &types.AppError{Error: errFileModified, Code: http.StatusPreconditionFailed}
+		}
+	}
+
+	return nil
+}
+
+// fileOperationVersions collects the versions a move of several files is
+// conditional on, from the versions field or from If-Match when a single file
+// is moved.
+func fileOperationVersions(c *gin.Context, payload *schemas.FileOperation) (map[string]int, *types.AppError) {
+	versions := make(map[string]int)
+
+	for _, id := range payload.Files {
+		if version, ok := payload.Versions[id]; ok {
+			versions[id] = version
+		}
+	}
+
+	if len(payload.Files) == 1 && len(versions) == 0 {
+		version, err := ifMatchVersion(c)
+		if err != nil {
+			return nil, err
+		}
+		if version != nil {
+			versions[payload.Files[0]] = *version
+		}
+		return versions, nil
+	}
+
+	if utils.GetConfig().StrictIfMatch && len(versions) != len(payload.Files) {
+		return nil, &types.AppError{Error: errors.New("versions required for all files"), Code: http.StatusPreconditionRequired}
+	}
+
+	return versions, nil
+}
@@ -27,12 +27,15 @@ type JWTClaims struct {
 }
 
 type TgSession struct {
-	Sesssion  string `json:"session"`
-	UserID    int64  `json:"userId"`
-	Bot       bool   `json:"bot"`
-	UserName  string `json:"userName"`
-	Name      string `json:"name"`
-	IsPremium bool   `json:"isPremium"`
+	Sesssion   string `json:"session"`
+	UserID     int64  `json:"userId"`
+	Bot        bool   `json:"bot"`
+	UserName   string `json:"userName"`
+	Name       string `json:"name"`
+	IsPremium  bool   `json:"isPremium"`
+	InviteCode string `json:"inviteCode,omitempty"`
+	Otp        string `json:"otp,omitempty"`
+	MFATicket  string `json:"mfaTicket,omitempty"`
 }
 
 type Session struct {
@@ -42,3 +45,14 @@ type Session struct {
 	Hash      string `json:"hash"`
 	Expires   string `json:"expires"`
 }
+
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeWrite  = "write"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
@@ -2,7 +2,6 @@ package auth
 
 import (
 	"encoding/json"
-	"os"
 
 	"github.com/divyam234/teldrive/types"
 	"github.com/go-jose/go-jose/v3"
@@ -10,9 +9,12 @@ import (
 
 func Encode(payload *types.JWTClaims) (string, error) {
 
+	kid, secret := keys.signingKey()
+
 	rcpt := jose.Recipient{
 		Algorithm: jose.PBES2_HS256_A128KW,
-		Key:       os.Getenv("JWT_SECRET"),
+		Key:       secret,
+		KeyID:     kid,
 	}
 
 	enc, err := jose.NewEncrypter(jose.A128CBC_HS256, rcpt, nil)
@@ -43,7 +45,13 @@ func Decode(token string) (*types.JWTClaims, error) {
 		return nil, err
 	}
 
-	decryptedData, err := jwe.Decrypt(os.Getenv("JWT_SECRET"))
+	secret, err := keys.decryptionKey(jwe.Header.KeyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedData, err := jwe.Decrypt(secret)
 
 	if err != nil {
 		return nil, err
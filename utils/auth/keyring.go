@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/secret"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownKey = errors.New("unknown key id")
+
+// legacyKeyID marks JWT_SECRET in the keyring. The first rotation stores it
+// as a retired key without a secret, tokens without a key id are accepted
+// until it is pruned like any other retired key.
+const legacyKeyID = "legacy"
+
+// keyring holds the active signing key and every key still accepted for
+// decryption. Tokens without a key id fall back to JWT_SECRET until the
+// first rotation is older than the session lifetime.
+type keyring struct {
+	mu     sync.RWMutex
+	active *models.JWTKey
+	keys   map[string]*models.JWTKey
+}
+
+var keys = &keyring{keys: make(map[string]*models.JWTKey)}
+
+func (k *keyring) signingKey() (string, string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == nil {
+		return "", utils.GetConfig().JwtSecret
+	}
+	return k.active.ID, k.active.Secret
+}
+
+func (k *keyring) decryptionKey(kid string) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if kid == "" {
+		if _, ok := k.keys[legacyKeyID]; ok || len(k.keys) == 0 {
+			return utils.GetConfig().JwtSecret, nil
+		}
+		return "", ErrUnknownKey
+	}
+	if kid == legacyKeyID {
+		return "", ErrUnknownKey
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	return key.Secret, nil
+}
+
+// LoadKeys refreshes the in-memory keyring from the database. It is run at
+// startup and periodically so rotations by other processes are picked up.
+func LoadKeys(db *gorm.DB) error {
+	var rows []models.JWTKey
+
+	if err := db.Model(&models.JWTKey{}).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keyMap := make(map[string]*models.JWTKey, len(rows))
+
+	var active *models.JWTKey
+
+	for i := range rows {
+		plain, err := secret.Decrypt(rows[i].Secret)
+		if err != nil {
+			return err
+		}
+		rows[i].Secret = plain
+		keyMap[rows[i].ID] = &rows[i]
+		if rows[i].Active {
+			active = &rows[i]
+		}
+	}
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.active = active
+	keys.keys = keyMap
+	return nil
+}
+
+// RotateKeys creates a new active key, retires the previous one and prunes
+// keys retired longer than retention ago, after which no session can still
+// be using them.
+func RotateKeys(db *gorm.DB, retention time.Duration) (*models.JWTKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	sealed, err := secret.Encrypt(base64.RawURLEncoding.EncodeToString(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.JWTKey{ID: hex.EncodeToString(id), Secret: sealed, Active: true}
+
+	now := time.Now().UTC()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&models.JWTKey{}).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			if err := tx.Create(&models.JWTKey{ID: legacyKeyID, RetiredAt: &now}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.JWTKey{}).Where("active = ?", true).
+			Updates(map[string]interface{}{"active": false, "retired_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		return tx.Where("retired_at < ?", now.Add(-retention)).Delete(&models.JWTKey{}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, LoadKeys(db)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/types"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+const jwtSecret = "jwt-secret"
+
+// setKeys replaces the keyring as LoadKeys would after reading rows.
+func setKeys(t *testing.T, rows ...models.JWTKey) {
+	t.Helper()
+
+	prevSecret := utils.GetConfig().JwtSecret
+	utils.GetConfig().JwtSecret = jwtSecret
+
+	keys.mu.Lock()
+	prevActive, prevKeys := keys.active, keys.keys
+	keys.active, keys.keys = nil, make(map[string]*models.JWTKey, len(rows))
+	for i := range rows {
+		keys.keys[rows[i].ID] = &rows[i]
+		if rows[i].Active {
+			keys.active = &rows[i]
+		}
+	}
+	keys.mu.Unlock()
+
+	t.Cleanup(func() {
+		utils.GetConfig().JwtSecret = prevSecret
+		keys.mu.Lock()
+		keys.active, keys.keys = prevActive, prevKeys
+		keys.mu.Unlock()
+	})
+}
+
+func TestDecryptionKey(t *testing.T) {
+	retired := time.Now().UTC()
+
+	legacy := models.JWTKey{ID: legacyKeyID, RetiredAt: &retired}
+	old := models.JWTKey{ID: "old", Secret: "old-secret", RetiredAt: &retired}
+	current := models.JWTKey{ID: "current", Secret: "current-secret", Active: true}
+
+	tests := []struct {
+		name   string
+		rows   []models.JWTKey
+		kid    string
+		secret string
+		err    error
+	}{
+		{"never rotated, no kid", nil, "", jwtSecret, nil},
+		{"never rotated, unknown kid", nil, "current", "", ErrUnknownKey},
+		{"rotated, no kid falls back to legacy", []models.JWTKey{legacy, current}, "", jwtSecret, nil},
+		{"rotated, active kid", []models.JWTKey{legacy, current}, "current", "current-secret", nil},
+		{"rotated, retired kid", []models.JWTKey{legacy, old, current}, "old", "old-secret", nil},
+		{"rotated, legacy kid", []models.JWTKey{legacy, current}, legacyKeyID, "", ErrUnknownKey},
+		{"legacy pruned, no kid", []models.JWTKey{old, current}, "", "", ErrUnknownKey},
+		{"retired key pruned", []models.JWTKey{current}, "old", "", ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setKeys(t, tt.rows...)
+			secret, err := keys.decryptionKey(tt.kid)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("decryptionKey(%q) error = %v, want %v", tt.kid, err, tt.err)
+			}
+			if secret != tt.secret {
+				t.Errorf("decryptionKey(%q) = %q, want %q", tt.kid, secret, tt.secret)
+			}
+		})
+	}
+}
+
+func TestDecodeAcrossRotation(t *testing.T) {
+	retired := time.Now().UTC()
+
+	legacy := models.JWTKey{ID: legacyKeyID, RetiredAt: &retired}
+	current := models.JWTKey{ID: "current", Secret: "current-secret", Active: true}
+
+	claims := &types.JWTClaims{Claims: jwt.Claims{Subject: "42"}}
+
+	setKeys(t)
+
+	legacyToken, err := Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setKeys(t, legacy, current)
+
+	currentToken, err := Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rows  []models.JWTKey
+		token string
+		ok    bool
+	}{
+		{"legacy token before pruning", []models.JWTKey{legacy, current}, legacyToken, true},
+		{"legacy token after pruning", []models.JWTKey{current}, legacyToken, false},
+		{"current token", []models.JWTKey{current}, currentToken, true},
+		{"current token after its key was pruned", []models.JWTKey{legacy}, currentToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setKeys(t, tt.rows...)
+			got, err := Decode(tt.token)
+			if tt.ok != (err == nil) {
+				t.Fatalf("Decode() error = %v, want ok = %v", err, tt.ok)
+			}
+			if tt.ok && got.Subject != "42" {
+				t.Errorf("Decode() subject = %q, want %q", got.Subject, "42")
+			}
+		})
+	}
+}
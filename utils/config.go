@@ -2,6 +2,7 @@ package utils
 
 import (
 	"path/filepath"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -10,28 +11,51 @@ import (
 type MultiToken string
 
 type Config struct {
-	AppId                  int      `envconfig:"APP_ID" required:"true"`
-	AppHash                string   `envconfig:"APP_HASH" required:"true"`
-	JwtSecret              string   `envconfig:"JWT_SECRET" required:"true"`
-	Https                  bool     `envconfig:"HTTPS" default:"false"`
-	CookieSameSite         bool     `envconfig:"COOKIE_SAME_SITE" default:"true"`
-	AllowedUsers           []string `envconfig:"ALLOWED_USERS"`
-	DatabaseUrl            string   `envconfig:"DATABASE_URL" required:"true"`
-	RateLimit              bool     `envconfig:"RATE_LIMIT" default:"true"`
-	RateBurst              int      `envconfig:"RATE_BURST" default:"5"`
-	Rate                   int      `envconfig:"RATE" default:"100"`
-	TgClientDeviceModel    string   `envconfig:"TG_CLIENT_DEVICE_MODEL" default:"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/116.0"`
-	TgClientSystemVersion  string   `envconfig:"TG_CLIENT_SYSTEM_VERSION" default:"Win32"`
-	TgClientAppVersion     string   `envconfig:"TG_CLIENT_APP_VERSION" default:"2.1.9 K"`
-	TgClientLangCode       string   `envconfig:"TG_CLIENT_LANG_CODE" default:"en"`
-	TgClientSystemLangCode string   `envconfig:"TG_CLIENT_SYSTEM_LANG_CODE" default:"en"`
-	TgClientLangPack       string   `envconfig:"TG_CLIENT_LANG_PACK" default:"webk"`
-	RunMigrations          bool     `envconfig:"RUN_MIGRATIONS" default:"true"`
-	Port                   int      `envconfig:"PORT" default:"8080"`
-	LazyStreamBots         bool     `envconfig:"LAZY_STREAM_BOTS" default:"false"`
-	BgBotsLimit            int      `envconfig:"BG_BOTS_LIMIT" default:"5"`
-	UploadRetention        int      `envconfig:"UPLOAD_RETENTION" default:"15"`
-	DisableStreamBots      bool     `envconfig:"DISABLE_STREAM_BOTS" default:"false"`
+	AppId                  int               `envconfig:"APP_ID" required:"true"`
+	AppHash                string            `envconfig:"APP_HASH" required:"true"`
+	JwtSecret              string            `envconfig:"JWT_SECRET" required:"true"`
+	Https                  bool              `envconfig:"HTTPS" default:"false"`
+	CookieSameSite         bool              `envconfig:"COOKIE_SAME_SITE" default:"true"`
+	CorsAllowedOrigins     []string          `envconfig:"CORS_ALLOWED_ORIGINS"`
+	AllowedUsers           []string          `envconfig:"ALLOWED_USERS"`
+	AdminUsers             []int64           `envconfig:"ADMIN_USERS"`
+	DatabaseUrl            string            `envconfig:"DATABASE_URL" required:"true"`
+	RateLimit              bool              `envconfig:"RATE_LIMIT" default:"true"`
+	HttpRateLimits         map[string]string `envconfig:"HTTP_RATE_LIMITS"`
+	AuthMaxFailures        int               `envconfig:"AUTH_MAX_FAILURES" default:"5"`
+	AuthLockout            time.Duration     `envconfig:"AUTH_LOCKOUT" default:"15m"`
+	RateBurst              int               `envconfig:"RATE_BURST" default:"5"`
+	Rate                   int               `envconfig:"RATE" default:"100"`
+	TgClientDeviceModel    string            `envconfig:"TG_CLIENT_DEVICE_MODEL" default:"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/116.0"`
+	TgClientSystemVersion  string            `envconfig:"TG_CLIENT_SYSTEM_VERSION" default:"Win32"`
+	TgClientAppVersion     string            `envconfig:"TG_CLIENT_APP_VERSION" default:"2.1.9 K"`
+	TgClientLangCode       string            `envconfig:"TG_CLIENT_LANG_CODE" default:"en"`
+	TgClientSystemLangCode string            `envconfig:"TG_CLIENT_SYSTEM_LANG_CODE" default:"en"`
+	TgClientLangPack       string            `envconfig:"TG_CLIENT_LANG_PACK" default:"webk"`
+	RunMigrations          bool              `envconfig:"RUN_MIGRATIONS" default:"true"`
+	Port                   int               `envconfig:"PORT" default:"8080"`
+	LazyStreamBots         bool              `envconfig:"LAZY_STREAM_BOTS" default:"false"`
+	BgBotsLimit            int               `envconfig:"BG_BOTS_LIMIT" default:"5"`
+	UploadRetention        int               `envconfig:"UPLOAD_RETENTION" default:"15"`
+	DisableStreamBots      bool              `envconfig:"DISABLE_STREAM_BOTS" default:"false"`
+	SessionMaxLifetime     time.Duration     `envconfig:"SESSION_MAX_LIFETIME" default:"2160h"`
+	MasterKey              string            `envconfig:"MASTER_KEY"`
+	QuotaBytes             int64             `envconfig:"QUOTA_BYTES" default:"0"`
+	QuotaFiles             int64             `envconfig:"QUOTA_FILES" default:"0"`
+	MaxFileSize            int64             `envconfig:"MAX_FILE_SIZE" default:"0"`
+	AllowedMimeTypes       []string          `envconfig:"ALLOWED_MIME_TYPES"`
+	BlockedMimeTypes       []string          `envconfig:"BLOCKED_MIME_TYPES"`
+	AllowedExtensions      []string          `envconfig:"ALLOWED_EXTENSIONS"`
+	BlockedExtensions      []string          `envconfig:"BLOCKED_EXTENSIONS"`
+	UserClientIdleTimeout  time.Duration     `envconfig:"USER_CLIENT_IDLE_TIMEOUT" default:"15m"`
+	UploadSplitSize        int64             `envconfig:"UPLOAD_SPLIT_SIZE" default:"524288000"`
+	UploadThreads          int               `envconfig:"UPLOAD_THREADS" default:"16"`
+	UploadPartSize         int               `envconfig:"UPLOAD_PART_SIZE" default:"524288"`
+	UploadStagingDir       string            `envconfig:"UPLOAD_STAGING_DIR"`
+	UploadWorkers          int               `envconfig:"UPLOAD_WORKERS" default:"2"`
+	UploadMaxAttempts      int               `envconfig:"UPLOAD_MAX_ATTEMPTS" default:"5"`
+	IdempotencyRetention   time.Duration     `envconfig:"IDEMPOTENCY_RETENTION" default:"24h"`
+	StrictIfMatch          bool              `envconfig:"STRICT_IF_MATCH" default:"false"`
 	ExecDir                string
 }
 
@@ -47,6 +71,9 @@ func InitConfig() {
 		panic(err)
 	}
 	config.ExecDir = execDir
+	if config.UploadStagingDir == "" {
+		config.UploadStagingDir = filepath.Join(execDir, "staging")
+	}
 }
 
 func GetConfig() *Config {
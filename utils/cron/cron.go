@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"os"
 	"strconv"
 	"time"
 
@@ -11,8 +12,10 @@ import (
 	"github.com/divyam234/teldrive/models"
 	"github.com/divyam234/teldrive/services"
 	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/events"
 	"github.com/divyam234/teldrive/utils/tgc"
 	"github.com/gotd/td/tg"
+	"gorm.io/gorm/clause"
 )
 
 type Files []File
@@ -101,10 +104,17 @@ func deleteTGMessages(ctx context.Context, result Result) error {
 		}
 		return nil
 	})
+	event := events.Event{Type: events.TypeDelete, ID: strconv.FormatInt(result.ChannelId, 10),
+		Status: events.StatusDone, Done: int64(len(fileIds)), Total: int64(len(fileIds))}
+
 	if err == nil {
 		db.Where("id = any($1)", fileIds).Delete(&models.File{})
+	} else {
+		event.Status, event.Done, event.Error = events.StatusFailed, 0, err.Error()
 	}
 
+	events.Bus.Publish(result.UserId, event)
+
 	return nil
 }
 
@@ -143,10 +153,17 @@ func cleanUploadsMessages(ctx context.Context, result UploadResult) error {
 		}
 		return nil
 	})
+	event := events.Event{Type: events.TypeUploadClean, ID: strconv.FormatInt(result.ChannelId, 10),
+		Status: events.StatusDone, Done: int64(len(fileIds)), Total: int64(len(fileIds))}
+
 	if err == nil {
 		db.Where("id = any($1)", fileIds).Delete(&models.Upload{})
+	} else {
+		event.Status, event.Done, event.Error = events.StatusFailed, 0, err.Error()
 	}
 
+	events.Bus.Publish(result.UserId, event)
+
 	return nil
 }
 
@@ -193,4 +210,35 @@ func UploadCleanJob() {
 	for _, row := range upResults {
 		cleanUploadsMessages(ctx, row)
 	}
+
+	var jobs []models.UploadJob
+
+	db.Clauses(clause.Returning{}).Where("status in ?", []string{"done", "failed", "cancelled"}).
+		Where("updated_at < ?", time.Now().UTC().AddDate(0, 0, -config.UploadRetention)).
+		Delete(&jobs)
+
+	for _, job := range jobs {
+		os.Remove(job.Path)
+	}
+}
+
+func IdempotencyCleanJob() {
+	database.DB.Where("created_at < ?", time.Now().UTC().Add(-utils.GetConfig().IdempotencyRetention)).
+		Delete(&models.IdempotencyKey{})
+}
+
+// copyJobStaleAfter is how long a running copy job may go without a
+// heartbeat before it is considered interrupted.
+const copyJobStaleAfter = 10 * time.Minute
+
+func CopyJobsCleanJob() {
+	db := database.DB
+
+	db.Model(&models.CopyJob{}).Where("status = ?", "running").
+		Where("updated_at < ?", time.Now().UTC().Add(-copyJobStaleAfter)).
+		Updates(map[string]interface{}{"status": "failed", "error": "interrupted", "updated_at": time.Now().UTC()})
+
+	db.Where("status != ?", "running").
+		Where("updated_at < ?", time.Now().UTC().AddDate(0, 0, -utils.GetConfig().UploadRetention)).
+		Delete(&models.CopyJob{})
 }
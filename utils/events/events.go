@@ -0,0 +1,136 @@
+package events
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	TypeUpload      = "upload"
+	TypeCopy        = "copy"
+	TypeDelete      = "delete"
+	TypeUploadClean = "upload_clean"
+
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Event reports the progress of an upload or a background job to the user
+// that owns it.
+type Event struct {
+	Type   string    `json:"type"`
+	ID     string    `json:"id"`
+	PartNo int       `json:"partNo,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	Status string    `json:"status"`
+	Done   int64     `json:"done"`
+	Total  int64     `json:"total"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// progressInterval limits how often a Reader publishes while data flows.
+const progressInterval = 500 * time.Millisecond
+
+// Hub fans events out to the subscribers of each user. Delivery is best
+// effort, publishers never block on a subscriber.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[int64]map[chan Event]struct{}
+}
+
+var Bus = &Hub{subs: make(map[int64]map[chan Event]struct{})}
+
+// Subscribe returns a channel with the events of userId and a function that
+// ends the subscription.
+func (h *Hub) Subscribe(userId int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[userId] == nil {
+		h.subs[userId] = make(map[chan Event]struct{})
+	}
+	h.subs[userId][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[userId], ch)
+			if len(h.subs[userId]) == 0 {
+				delete(h.subs, userId)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+func (h *Hub) Publish(userId int64, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subs[userId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (h *Hub) hasSubscribers(userId int64) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs[userId]) > 0
+}
+
+// Reader publishes running events for event as data is read from r.
+type Reader struct {
+	r      io.Reader
+	userId int64
+	event  Event
+	last   time.Time
+}
+
+func NewReader(r io.Reader, userId int64, event Event) *Reader {
+	event.Status = StatusRunning
+	return &Reader{r: r, userId: userId, event: event}
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.event.Done += int64(n)
+	if now := time.Now(); now.Sub(r.last) >= progressInterval && Bus.hasSubscribers(r.userId) {
+		r.last = now
+		Bus.Publish(r.userId, r.event)
+	}
+	return n, err
+}
+
+// Finish publishes the final state of the event, failed when err is set.
+func (r *Reader) Finish(err error) {
+	event := r.event
+	event.Time = time.Time{}
+	if err != nil {
+		event.Status = StatusFailed
+		event.Error = err.Error()
+	} else {
+		event.Status = StatusDone
+		if event.Total > 0 {
+			event.Done = event.Total
+		}
+	}
+	Bus.Publish(r.userId, event)
+}
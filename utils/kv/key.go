@@ -1,9 +1,18 @@
 package kv
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 )
 
 func Key(indexes ...string) string {
 	return strings.Join(indexes, ":")
 }
+
+// BotSessionKey keys bot sessions by a digest of the token so the bbolt file
+// does not carry raw bot tokens.
+func BotSessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return Key("botsession", hex.EncodeToString(sum[:]))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/divyam234/teldrive/utils/secret"
 	"github.com/gotd/td/telegram"
 )
 
@@ -25,9 +26,13 @@ func (s *Session) LoadSession(_ context.Context) ([]byte, error) {
 		}
 		return nil, err
 	}
-	return b, nil
+	return secret.DecryptBytes(b)
 }
 
 func (s *Session) StoreSession(_ context.Context, data []byte) error {
-	return s.kv.Set(s.key, data)
+	sealed, err := secret.EncryptBytes(data)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(s.key, sealed)
 }
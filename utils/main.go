@@ -77,6 +77,10 @@ func IntPointer(b int) *int {
 	return &b
 }
 
+func StringPointer(s string) *string {
+	return &s
+}
+
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
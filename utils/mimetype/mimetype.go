@@ -0,0 +1,106 @@
+package mimetype
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// SniffLen is how many leading bytes are looked at, the same as
+// http.DetectContentType.
+const SniffLen = 512
+
+const Default = "application/octet-stream"
+
+// containers are detected from their magic number but say little about the
+// actual format, e.g. docx and jar are zip files.
+var containers = map[string]bool{
+	"application/zip":          true,
+	"application/x-gzip":       true,
+	"application/octet-stream": true,
+	"text/plain":               true,
+	"text/xml":                 true,
+	"application/ogg":          true,
+}
+
+// Detect combines the magic number of head with the extension of name. The
+// extension wins when the content is a generic container, or for audio and
+// video when both agree on the top level type since the extension is more
+// specific there (video/webm vs video/x-matroska). It never returns an empty
+// string.
+func Detect(name string, head []byte) string {
+	byExt := ByExtension(name)
+
+	if len(head) == 0 {
+		if byExt != "" {
+			return byExt
+		}
+		return Default
+	}
+
+	sniffed, _, _ := strings.Cut(http.DetectContentType(head), ";")
+
+	if byExt == "" {
+		return sniffed
+	}
+
+	top := topLevel(sniffed)
+
+	if containers[sniffed] || ((top == "video" || top == "audio") && top == topLevel(byExt)) {
+		return byExt
+	}
+
+	return sniffed
+}
+
+func ByExtension(name string) string {
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	byExt, _, _ = strings.Cut(byExt, ";")
+	return byExt
+}
+
+func topLevel(mimeType string) string {
+	top, _, _ := strings.Cut(mimeType, "/")
+	return top
+}
+
+// Reader keeps the first SniffLen bytes read through it.
+type Reader struct {
+	r    io.Reader
+	head []byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, head: make([]byte, 0, SniffLen)}
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if missing := SniffLen - len(r.head); missing > 0 && n > 0 {
+		r.head = append(r.head, b[:min(n, missing)]...)
+	}
+	return n, err
+}
+
+func (r *Reader) Head() []byte {
+	return r.head
+}
+
+// Head reads the first SniffLen bytes of r and rewinds it.
+func Head(r io.ReadSeeker) ([]byte, error) {
+	head := make([]byte, SniffLen)
+
+	n, err := io.ReadFull(r, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return head[:n], nil
+}
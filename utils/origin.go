@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// OriginAllowed reports whether origin is in CORS_ALLOWED_ORIGINS.
+func OriginAllowed(origin string) bool {
+	origin = normalizeOrigin(origin)
+	for _, allowed := range config.CorsAllowedOrigins {
+		if normalizeOrigin(allowed) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// SameOrigin reports whether the request Origin points at the host serving it.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// CheckOrigin accepts requests without an Origin header, same origin requests
+// and requests from allowed origins.
+func CheckOrigin(r *http.Request) bool {
+	return SameOrigin(r) || OriginAllowed(r.Header.Get("Origin"))
+}
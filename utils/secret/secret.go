@@ -0,0 +1,146 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/divyam234/teldrive/utils"
+)
+
+// Secrets are sealed with a random data key which is itself sealed with the
+// master key, and stored as prefix + wrapped key + "." + ciphertext.
+const prefix = "enc:v1:"
+
+var ErrNoMasterKey = errors.New("secret is encrypted but MASTER_KEY is not set")
+
+func masterKey() []byte {
+	key := utils.GetConfig().MasterKey
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func Enabled() bool {
+	return utils.GetConfig().MasterKey != ""
+}
+
+func IsEncrypted(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(prefix))
+}
+
+func seal(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed secret")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// EncryptBytes seals plain with a fresh data key. Without a master key the
+// value is returned unchanged.
+func EncryptBytes(plain []byte) ([]byte, error) {
+	master := masterKey()
+	if master == nil || IsEncrypted(plain) {
+		return plain, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := seal(master, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(dataKey, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	out := prefix + base64.RawStdEncoding.EncodeToString(wrapped) + "." + base64.RawStdEncoding.EncodeToString(sealed)
+	return []byte(out), nil
+}
+
+// DecryptBytes opens a sealed value. Plaintext values written before
+// encryption was enabled are returned as they are.
+func DecryptBytes(value []byte) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	master := masterKey()
+	if master == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	parts := strings.SplitN(string(value[len(prefix):]), ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed secret")
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(master, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dataKey, sealed)
+}
+
+func Encrypt(plain string) (string, error) {
+	out, err := EncryptBytes([]byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func Decrypt(value string) (string, error) {
+	out, err := DecryptBytes([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
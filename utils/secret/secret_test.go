@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/divyam234/teldrive/utils"
+)
+
+func withMasterKey(t *testing.T, key string) {
+	t.Helper()
+	prev := utils.GetConfig().MasterKey
+	utils.GetConfig().MasterKey = key
+	t.Cleanup(func() { utils.GetConfig().MasterKey = prev })
+}
+
+func TestRoundTrip(t *testing.T) {
+	withMasterKey(t, "master")
+
+	sealed, err := Encrypt("bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(sealed, prefix) {
+		t.Fatalf("Encrypt() = %q, want %q prefix", sealed, prefix)
+	}
+
+	again, err := Encrypt(sealed)
+	if err != nil || again != sealed {
+		t.Fatalf("Encrypt() of a sealed value = %q, %v, want it unchanged", again, err)
+	}
+
+	plain, err := Decrypt(sealed)
+	if err != nil || plain != "bot-token" {
+		t.Fatalf("Decrypt() = %q, %v, want %q", plain, err, "bot-token")
+	}
+}
+
+func TestPlainPassesThrough(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey string
+	}{
+		{"without master key", ""},
+		{"with master key", "master"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMasterKey(t, tt.masterKey)
+			plain, err := Decrypt("bot-token")
+			if err != nil || plain != "bot-token" {
+				t.Errorf("Decrypt() = %q, %v, want %q", plain, err, "bot-token")
+			}
+		})
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	withMasterKey(t, "master")
+
+	sealed, err := Encrypt("bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, body, _ := strings.Cut(strings.TrimPrefix(sealed, prefix), ".")
+
+	tests := []struct {
+		name      string
+		masterKey string
+		value     string
+		err       error
+	}{
+		{"wrong master key", "other", sealed, nil},
+		{"no master key", "", sealed, ErrNoMasterKey},
+		{"truncated ciphertext", "master", sealed[:len(sealed)-4], nil},
+		{"truncated wrapped key", "master", prefix + wrapped[:8] + "." + body, nil},
+		{"missing separator", "master", prefix + wrapped + body, nil},
+		{"prefix only", "master", prefix, nil},
+		{"invalid base64", "master", prefix + "!!!." + body, nil},
+		{"swapped parts", "master", prefix + body + "." + wrapped, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMasterKey(t, tt.masterKey)
+			plain, err := Decrypt(tt.value)
+			if err == nil {
+				t.Fatalf("Decrypt() = %q, want an error", plain)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
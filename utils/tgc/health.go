@@ -0,0 +1,311 @@
+package tgc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/database"
+	"github.com/divyam234/teldrive/models"
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/cache"
+	"github.com/divyam234/teldrive/utils/secret"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+const (
+	BotHealthy   = "healthy"
+	BotFloodWait = "flood_wait"
+	BotCooldown  = "cooldown"
+	BotDisabled  = "disabled"
+)
+
+// errorThreshold consecutive failures put a bot in cooldown, doubling with
+// every further failure up to maxCooldown.
+const (
+	errorThreshold = 3
+	baseCooldown   = 10 * time.Second
+	maxCooldown    = 5 * time.Minute
+)
+
+var ErrNoHealthyBots = errors.New("no healthy bots available")
+
+// fatalBotErrors mean the token itself is unusable. They only count when
+// logging in with the token fails, auth key errors before that are the
+// normal state of a bot without a stored session.
+var fatalBotErrors = []string{
+	"ACCESS_TOKEN_INVALID",
+	"ACCESS_TOKEN_EXPIRED",
+	"BOT_INVALID",
+}
+
+type botHealth struct {
+	inFlight    int
+	errors      int
+	requests    int64
+	lastError   string
+	lastErrorAt time.Time
+	floodUntil  time.Time
+	disabled    string
+	latency     time.Duration
+	throughput  float64
+}
+
+// BotState is a snapshot of the health of one bot.
+type BotState struct {
+	BotID          int64
+	State          string
+	InFlight       int
+	Errors         int
+	Requests       int64
+	FloodWaitUntil *time.Time
+	CooldownUntil  *time.Time
+	DisabledReason string
+	LastError      string
+	LastErrorAt    *time.Time
+	AvgLatency     time.Duration
+	BytesPerSecond float64
+}
+
+type healthTracker struct {
+	mu   sync.Mutex
+	bots map[int64]*botHealth
+}
+
+// BotHealth tracks errors, FLOOD_WAIT deadlines, in-flight requests and
+// throughput of every bot client, the workers use it to pick bots.
+var BotHealth = &healthTracker{bots: make(map[int64]*botHealth)}
+
+func BotID(token string) int64 {
+	id, _ := strconv.ParseInt(strings.Split(token, ":")[0], 10, 64)
+	return id
+}
+
+func (h *healthTracker) get(botID int64) *botHealth {
+	b, ok := h.bots[botID]
+	if !ok {
+		b = &botHealth{}
+		h.bots[botID] = b
+	}
+	return b
+}
+
+func cooldownUntil(b *botHealth) time.Time {
+	if b.errors < errorThreshold {
+		return time.Time{}
+	}
+	wait := maxCooldown
+	if shift := b.errors - errorThreshold; shift < 6 {
+		wait = utils.Min(baseCooldown<<shift, maxCooldown)
+	}
+	return b.lastErrorAt.Add(wait)
+}
+
+func (b *botHealth) state(now time.Time) string {
+	switch {
+	case b.disabled != "":
+		return BotDisabled
+	case b.floodUntil.After(now):
+		return BotFloodWait
+	case cooldownUntil(b).After(now):
+		return BotCooldown
+	}
+	return BotHealthy
+}
+
+// readyAt is when a bot that is not healthy can be used again.
+func (b *botHealth) readyAt() time.Time {
+	ready := cooldownUntil(b)
+	if b.floodUntil.After(ready) {
+		ready = b.floodUntil
+	}
+	return ready
+}
+
+func transferred(input bin.Encoder, output bin.Decoder) int {
+	switch req := input.(type) {
+	case *tg.UploadSaveBigFilePartRequest:
+		return len(req.Bytes)
+	case *tg.UploadSaveFilePartRequest:
+		return len(req.Bytes)
+	}
+	if box, ok := output.(*tg.UploadFileBox); ok {
+		if file, ok := box.File.(*tg.UploadFile); ok {
+			return len(file.Bytes)
+		}
+	}
+	return 0
+}
+
+func (h *healthTracker) middleware(botID int64) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			h.mu.Lock()
+			h.get(botID).inFlight++
+			h.mu.Unlock()
+
+			start := time.Now()
+			err := next.Invoke(ctx, input, output)
+			h.record(botID, time.Since(start), transferred(input, output), err)
+			return err
+		}
+	})
+}
+
+func (h *healthTracker) record(botID int64, elapsed time.Duration, bytes int, err error) {
+	h.mu.Lock()
+	b := h.get(botID)
+	b.inFlight--
+	b.requests++
+
+	switch {
+	case err == nil:
+		b.errors = 0
+		b.latency = (b.latency*4 + elapsed) / 5
+		if bytes > 0 && elapsed > 0 {
+			rate := float64(bytes) / elapsed.Seconds()
+			if b.throughput == 0 {
+				b.throughput = rate
+			} else {
+				b.throughput = (b.throughput*4 + rate) / 5
+			}
+		}
+	case errors.Is(err, context.Canceled):
+	default:
+		b.lastError = err.Error()
+		b.lastErrorAt = time.Now()
+		if d, ok := tgerr.AsFloodWait(err); ok {
+			b.floodUntil = time.Now().Add(d)
+			break
+		}
+		b.errors++
+	}
+	h.mu.Unlock()
+}
+
+// loginFailed disables the token when Telegram refused it.
+func (h *healthTracker) loginFailed(token string, err error) {
+	var fatal string
+
+	botID := BotID(token)
+
+	h.mu.Lock()
+	b := h.get(botID)
+	for _, name := range fatalBotErrors {
+		if tgerr.Is(err, name) && b.disabled == "" {
+			b.disabled = name
+			fatal = name
+		}
+	}
+	h.mu.Unlock()
+
+	if fatal != "" {
+		utils.Logger.Warn("disabling bot", zap.Int64("bot", botID), zap.String("reason", fatal))
+		disableBot(token, fatal)
+	}
+}
+
+// disableBot keeps a broken token out of the pools after restarts as well.
+// Only the rows holding that exact token are disabled, a bot re-added with a
+// new token by another user keeps working.
+func disableBot(token, reason string) {
+	var bots []models.Bot
+	now := time.Now().UTC()
+	database.DB.Model(&models.Bot{}).Where("bot_id = ?", BotID(token)).Find(&bots)
+	for _, bot := range bots {
+		if plain, err := secret.Decrypt(bot.Token); err != nil || plain != token {
+			continue
+		}
+		database.DB.Model(&models.Bot{}).Where("token = ?", bot.Token).
+			Updates(map[string]interface{}{"disabled_reason": reason, "disabled_at": now})
+		cache.GetCache().Delete(fmt.Sprintf("users:bots:%d:%d", bot.UserID, bot.ChannelID))
+	}
+}
+
+// Enable clears the health state of a bot, used after a disabled bot token
+// was fixed.
+func (h *healthTracker) Enable(botID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.bots, botID)
+}
+
+// Pick returns the index of the least loaded healthy token. Ties go to the
+// lower latency and then to the first token after offset so equal bots still
+// rotate. When every bot is waiting, the one ready first is returned.
+func (h *healthTracker) Pick(tokens []string, offset int) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	best, fallback := -1, -1
+	var bestHealth, fallbackHealth *botHealth
+
+	for i := 0; i < len(tokens); i++ {
+		idx := (offset + i) % len(tokens)
+		b := h.get(BotID(tokens[idx]))
+		switch b.state(now) {
+		case BotHealthy:
+			if best == -1 || b.inFlight < bestHealth.inFlight ||
+				(b.inFlight == bestHealth.inFlight && b.latency < bestHealth.latency) {
+				best, bestHealth = idx, b
+			}
+		case BotFloodWait, BotCooldown:
+			if fallback == -1 || b.readyAt().Before(fallbackHealth.readyAt()) {
+				fallback, fallbackHealth = idx, b
+			}
+		}
+	}
+
+	if best != -1 {
+		return best, nil
+	}
+	if fallback != -1 {
+		return fallback, nil
+	}
+	return 0, ErrNoHealthyBots
+}
+
+func (h *healthTracker) Snapshot(botIDs []int64) []BotState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	res := make([]BotState, 0, len(botIDs))
+
+	for _, id := range botIDs {
+		b := h.get(id)
+		state := BotState{
+			BotID:          id,
+			State:          b.state(now),
+			InFlight:       b.inFlight,
+			Errors:         b.errors,
+			Requests:       b.requests,
+			DisabledReason: b.disabled,
+			LastError:      b.lastError,
+			AvgLatency:     b.latency,
+			BytesPerSecond: b.throughput,
+		}
+		if b.floodUntil.After(now) {
+			until := b.floodUntil
+			state.FloodWaitUntil = &until
+		}
+		if until := cooldownUntil(b); until.After(now) {
+			state.CooldownUntil = &until
+		}
+		if !b.lastErrorAt.IsZero() {
+			at := b.lastErrorAt
+			state.LastErrorAt = &at
+		}
+		res = append(res, state)
+	}
+	return res
+}
@@ -0,0 +1,268 @@
+package tgc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/utils"
+	"github.com/divyam234/teldrive/utils/secret"
+	"github.com/gotd/contrib/bg"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+var ErrPoolClosed = errors.New("client pool closed")
+
+type pooledClient struct {
+	key      string
+	client   *telegram.Client
+	stop     bg.StopFunc
+	ready    chan struct{}
+	err      error
+	lastUsed time.Time
+	active   int
+}
+
+// UserPool keeps connected clients for user sessions so requests and jobs
+// don't pay for a new connection and handshake every time. Clients are keyed
+// by session, dropped after being idle and reconnected on the next use when a
+// health check fails.
+type UserPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	owners  map[*telegram.Client]*pooledClient
+	closed  bool
+}
+
+var UserClients = &UserPool{
+	clients: make(map[string]*pooledClient),
+	owners:  make(map[*telegram.Client]*pooledClient),
+}
+
+func poolKey(sessionStr string) string {
+	sum := sha256.Sum256([]byte(sessionStr))
+	return hex.EncodeToString(sum[:])
+}
+
+func connectUser(sessionStr string) (*telegram.Client, bg.StopFunc, error) {
+	client, err := newUserClient(context.Background(), sessionStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stop, err := bg.Connect(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	status, err := client.Auth().Status(ctx)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	if !status.Authorized {
+		stop()
+		return nil, nil, errors.New("not authorized. please login first")
+	}
+
+	utils.Logger.Info("User Session",
+		zap.Int64("id", status.User.ID),
+		zap.String("username", status.User.Username))
+
+	return client, stop, nil
+}
+
+// Get returns a connected client for the session, connecting it on first use.
+func (p *UserPool) Get(ctx context.Context, sessionStr string) (*telegram.Client, error) {
+	sessionStr, err := secret.Decrypt(sessionStr)
+	if err != nil {
+		return nil, err
+	}
+
+	key := poolKey(sessionStr)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	pc, ok := p.clients[key]
+	if !ok {
+		pc = &pooledClient{key: key, ready: make(chan struct{})}
+		p.clients[key] = pc
+		p.mu.Unlock()
+
+		pc.client, pc.stop, pc.err = connectUser(sessionStr)
+
+		p.mu.Lock()
+		if pc.err != nil || p.closed {
+			if p.clients[key] == pc {
+				delete(p.clients, key)
+			}
+			if pc.err == nil {
+				pc.err = ErrPoolClosed
+				go pc.stop()
+			}
+		} else {
+			p.owners[pc.client] = pc
+		}
+		p.mu.Unlock()
+		close(pc.ready)
+	} else {
+		p.mu.Unlock()
+	}
+
+	select {
+	case <-pc.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if pc.err != nil {
+		return nil, pc.err
+	}
+
+	p.mu.Lock()
+	pc.lastUsed = time.Now()
+	p.mu.Unlock()
+
+	return pc.client, nil
+}
+
+// Hold marks a pooled client as busy so it is not dropped while idle checks
+// run. The returned func releases it again.
+func (p *UserPool) Hold(client *telegram.Client) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.owners[client]
+	if !ok {
+		return func() {}
+	}
+	pc.active++
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		pc.active--
+		pc.lastUsed = time.Now()
+	}
+}
+
+func (p *UserPool) owns(client *telegram.Client) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.owners[client]
+	return ok
+}
+
+func (p *UserPool) run(ctx context.Context, client *telegram.Client, f func(ctx context.Context) error) error {
+	release := p.Hold(client)
+	defer release()
+
+	err := f(ctx)
+
+	// RPC errors come from a working connection, anything else may mean the
+	// client is broken, so check it right away instead of on the next run.
+	if err != nil && ctx.Err() == nil {
+		if _, ok := tgerr.As(err); !ok {
+			go p.check(client)
+		}
+	}
+	return err
+}
+
+func (p *UserPool) check(client *telegram.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		p.mu.Lock()
+		pc, ok := p.owners[client]
+		p.mu.Unlock()
+		if ok {
+			utils.Logger.Warn("dropping unhealthy user client", zap.Error(err))
+			p.evict(pc)
+		}
+	}
+}
+
+func (p *UserPool) evict(pc *pooledClient) {
+	p.mu.Lock()
+	if p.clients[pc.key] == pc {
+		delete(p.clients, pc.key)
+	}
+	delete(p.owners, pc.client)
+	p.mu.Unlock()
+	pc.stop()
+}
+
+// Remove disconnects the client of a session, used after logging it out.
+func (p *UserPool) Remove(sessionStr string) {
+	sessionStr, err := secret.Decrypt(sessionStr)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	pc, ok := p.clients[poolKey(sessionStr)]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	<-pc.ready
+	if pc.err == nil {
+		p.evict(pc)
+	}
+}
+
+// Maintain drops clients idle for longer than USER_CLIENT_IDLE_TIMEOUT and
+// pings the rest.
+func (p *UserPool) Maintain() {
+	idleTimeout := utils.GetConfig().UserClientIdleTimeout
+
+	var idle, live []*pooledClient
+
+	p.mu.Lock()
+	for _, pc := range p.owners {
+		if pc.active == 0 && time.Since(pc.lastUsed) > idleTimeout {
+			idle = append(idle, pc)
+		} else {
+			live = append(live, pc)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		p.evict(pc)
+	}
+
+	for _, pc := range live {
+		p.check(pc.client)
+	}
+}
+
+// Close disconnects every client, new requests fail with ErrPoolClosed.
+func (p *UserPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	clients := make([]*pooledClient, 0, len(p.owners))
+	for _, pc := range p.owners {
+		clients = append(clients, pc)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, pc := range clients {
+		wg.Add(1)
+		go func(pc *pooledClient) {
+			defer wg.Done()
+			p.evict(pc)
+		}(pc)
+	}
+	wg.Wait()
+}
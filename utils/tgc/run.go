@@ -10,6 +10,9 @@ import (
 )
 
 func RunWithAuth(ctx context.Context, client *telegram.Client, token string, f func(ctx context.Context) error) error {
+	if UserClients.owns(client) {
+		return UserClients.run(ctx, client, f)
+	}
 	return client.Run(ctx, func(ctx context.Context) error {
 		status, err := client.Auth().Status(ctx)
 		if err != nil {
@@ -28,6 +31,7 @@ func RunWithAuth(ctx context.Context, client *telegram.Client, token string, f f
 				utils.Logger.Info("creating bot session")
 				_, err := client.Auth().Bot(ctx, token)
 				if err != nil {
+					BotHealth.loginFailed(token, err)
 					return err
 				}
 				status, _ = client.Auth().Status(ctx)
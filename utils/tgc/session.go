@@ -0,0 +1,261 @@
+package tgc
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/session"
+)
+
+const (
+	FormatTelethon = "telethon"
+	FormatPyrogram = "pyrogram"
+	FormatGramJS   = "gramjs"
+	FormatGotd     = "gotd"
+)
+
+var ErrUnknownSessionFormat = errors.New("unsupported session format")
+
+var dcAddrs = map[int]string{
+	1: "149.154.175.53",
+	2: "149.154.167.51",
+	3: "149.154.175.100",
+	4: "149.154.167.91",
+	5: "91.108.56.130",
+}
+
+// SessionInfo is the session data together with the account details some
+// formats carry.
+type SessionInfo struct {
+	Data   *session.Data
+	Format string
+	UserID int64
+	Bot    bool
+}
+
+type gotdSession struct {
+	Version int
+	Data    session.Data
+}
+
+func authKeyID(key []byte) []byte {
+	sum := sha1.Sum(key)
+	return sum[12:20]
+}
+
+func dcAddr(dc int) (string, error) {
+	ip, ok := dcAddrs[dc]
+	if !ok {
+		return "", fmt.Errorf("unknown dc %d", dc)
+	}
+	return net.JoinHostPort(ip, "443"), nil
+}
+
+// ParseSession detects and decodes Telethon, Pyrogram, GramJS string sessions
+// and gotd JSON sessions.
+func ParseSession(value string) (*SessionInfo, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return nil, ErrUnknownSessionFormat
+	case strings.HasPrefix(value, "{"):
+		return parseGotd(value)
+	case value[0] == '1':
+		if info, err := parseGramJS(value[1:]); err == nil {
+			return info, nil
+		}
+		data, err := session.TelethonSession(value)
+		if err != nil {
+			return nil, ErrUnknownSessionFormat
+		}
+		return &SessionInfo{Data: data, Format: FormatTelethon}, nil
+	default:
+		return parsePyrogram(value)
+	}
+}
+
+func parseGotd(value string) (*SessionInfo, error) {
+	var wrapped gotdSession
+	if err := json.Unmarshal([]byte(value), &wrapped); err != nil {
+		return nil, ErrUnknownSessionFormat
+	}
+	data := wrapped.Data
+	if wrapped.Version == 0 {
+		if err := json.Unmarshal([]byte(value), &data); err != nil {
+			return nil, ErrUnknownSessionFormat
+		}
+	}
+	if len(data.AuthKey) != 256 || data.DC == 0 {
+		return nil, ErrUnknownSessionFormat
+	}
+	if data.Addr == "" {
+		addr, err := dcAddr(data.DC)
+		if err != nil {
+			return nil, err
+		}
+		data.Addr = addr
+	}
+	data.AuthKeyID = authKeyID(data.AuthKey)
+	return &SessionInfo{Data: &data, Format: FormatGotd}, nil
+}
+
+// parseGramJS decodes the StringSession body of GramJS, packed as dc id,
+// length prefixed server address, port and auth key.
+func parseGramJS(value string) (*SessionInfo, error) {
+	buf, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 3 {
+		return nil, ErrUnknownSessionFormat
+	}
+	addrLen := int(binary.BigEndian.Uint16(buf[1:3]))
+	if len(buf) != 1+2+addrLen+2+256 {
+		return nil, ErrUnknownSessionFormat
+	}
+	host := string(buf[3 : 3+addrLen])
+	if net.ParseIP(host) == nil {
+		return nil, ErrUnknownSessionFormat
+	}
+	port := binary.BigEndian.Uint16(buf[3+addrLen : 5+addrLen])
+	key := append([]byte{}, buf[5+addrLen:]...)
+	return &SessionInfo{
+		Data: &session.Data{
+			DC:        int(buf[0]),
+			Addr:      net.JoinHostPort(host, strconv.Itoa(int(port))),
+			AuthKey:   key,
+			AuthKeyID: authKeyID(key),
+		},
+		Format: FormatGramJS,
+	}, nil
+}
+
+// parsePyrogram decodes Pyrogram string sessions. Current versions pack
+// dc id, api id, test mode, auth key, user id and is bot, older ones lack the
+// api id and may use a 32 bit user id.
+func parsePyrogram(value string) (*SessionInfo, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, ErrUnknownSessionFormat
+	}
+
+	var (
+		dc, keyAt int
+		userID    int64
+		bot       bool
+	)
+
+	switch len(buf) {
+	case 271:
+		dc, keyAt = int(buf[0]), 6
+		userID = int64(binary.BigEndian.Uint64(buf[262:270]))
+		bot = buf[270] == 1
+	case 267:
+		dc, keyAt = int(buf[0]), 2
+		userID = int64(binary.BigEndian.Uint64(buf[258:266]))
+		bot = buf[266] == 1
+	case 263:
+		dc, keyAt = int(buf[0]), 2
+		userID = int64(binary.BigEndian.Uint32(buf[258:262]))
+		bot = buf[262] == 1
+	default:
+		return nil, ErrUnknownSessionFormat
+	}
+
+	if buf[keyAt-1] == 1 {
+		return nil, errors.New("test server sessions are not supported")
+	}
+
+	addr, err := dcAddr(dc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := append([]byte{}, buf[keyAt:keyAt+256]...)
+
+	return &SessionInfo{
+		Data: &session.Data{
+			DC:        dc,
+			Addr:      addr,
+			AuthKey:   key,
+			AuthKeyID: authKeyID(key),
+		},
+		Format: FormatPyrogram,
+		UserID: userID,
+		Bot:    bot,
+	}, nil
+}
+
+// EncodeSession packs session data in the given format. Pyrogram sessions
+// embed the api id and account, so they have to be passed along.
+func EncodeSession(data *session.Data, format string, appID int, userID int64, bot bool) (string, error) {
+	host, portStr, err := net.SplitHostPort(data.Addr)
+	if err != nil {
+		host, portStr = dcAddrs[data.DC], "443"
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	switch format {
+	case FormatTelethon:
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return "", fmt.Errorf("invalid address %s", host)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		buf := []byte{byte(data.DC)}
+		buf = append(buf, ip...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(port))
+		buf = append(buf, data.AuthKey...)
+		return "1" + base64.URLEncoding.EncodeToString(buf), nil
+	case FormatGramJS:
+		buf := []byte{byte(data.DC)}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(host)))
+		buf = append(buf, host...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(port))
+		buf = append(buf, data.AuthKey...)
+		return "1" + base64.StdEncoding.EncodeToString(buf), nil
+	case FormatPyrogram:
+		buf := []byte{byte(data.DC)}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(appID))
+		buf = append(buf, 0)
+		buf = append(buf, data.AuthKey...)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(userID))
+		if bot {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		return base64.RawURLEncoding.EncodeToString(buf), nil
+	case FormatGotd:
+		buf, err := json.Marshal(gotdSession{Version: 1, Data: *data})
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	return "", ErrUnknownSessionFormat
+}
+
+// NormalizeSession converts any supported session string to the Telethon
+// format teldrive stores.
+func NormalizeSession(value string) (*SessionInfo, string, error) {
+	info, err := ParseSession(value)
+	if err != nil {
+		return nil, "", err
+	}
+	normalized, err := EncodeSession(info.Data, FormatTelethon, 0, 0, false)
+	if err != nil {
+		return nil, "", err
+	}
+	return info, normalized, nil
+}
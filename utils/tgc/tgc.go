@@ -10,6 +10,7 @@ import (
 	"github.com/divyam234/teldrive/utils/kv"
 	"github.com/divyam234/teldrive/utils/recovery"
 	"github.com/divyam234/teldrive/utils/retry"
+	"github.com/divyam234/teldrive/utils/secret"
 	"github.com/gotd/contrib/middleware/floodwait"
 	"github.com/gotd/contrib/middleware/ratelimit"
 	tdclock "github.com/gotd/td/clock"
@@ -74,12 +75,18 @@ func NoLogin(ctx context.Context, handler telegram.UpdateHandler, storage sessio
 	return New(ctx, handler, storage, middlewares...)
 }
 
+// UserLogin returns the pooled, already connected client of a user session.
 func UserLogin(ctx context.Context, sessionStr string) (*telegram.Client, error) {
-	data, err := session.TelethonSession(sessionStr)
+	return UserClients.Get(ctx, sessionStr)
+}
+
+func newUserClient(ctx context.Context, sessionStr string) (*telegram.Client, error) {
+	info, err := ParseSession(sessionStr)
 
 	if err != nil {
 		return nil, err
 	}
+	data := info.Data
 
 	var (
 		storage = new(session.StorageMemory)
@@ -96,13 +103,18 @@ func UserLogin(ctx context.Context, sessionStr string) (*telegram.Client, error)
 }
 
 func BotLogin(ctx context.Context, token string) (*telegram.Client, error) {
+	token, err := secret.Decrypt(token)
+	if err != nil {
+		return nil, err
+	}
 	config := utils.GetConfig()
-	storage := kv.NewSession(database.KV, kv.Key("botsession", token))
+	storage := kv.NewSession(database.KV, kv.BotSessionKey(token))
 	middlewares, _ := NewDefaultMiddlewares(ctx)
 	if config.RateLimit {
 		middlewares = append(middlewares, ratelimit.New(rate.Every(time.Millisecond*time.Duration(config.Rate)), config.RateBurst))
 
 	}
+	middlewares = append(middlewares, BotHealth.middleware(BotID(token)))
 	return New(ctx, nil, storage, middlewares...), nil
 }
 func Backoff(_clock tdclock.Clock) backoff.BackOff {
@@ -0,0 +1,158 @@
+package tgc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/utils"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	maxUploadThreads = 32
+	minPartSize      = 1024
+	maxPartSize      = uploader.MaximumPartSize
+	// maxUploadParts is the Telegram limit of parts in one file.
+	maxUploadParts = 4000
+	// Part uploads slower than slowPart are treated like a FLOOD_WAIT, the
+	// client most likely waited on one.
+	slowPart = 5 * time.Second
+	fastPart = time.Second
+)
+
+// UploadParams are the uploader settings used for one upload.
+type UploadParams struct {
+	Threads  int
+	PartSize int
+}
+
+// UploadStats is what was observed while uploading.
+type UploadStats struct {
+	Parts      int
+	SlowParts  int
+	FloodWaits int
+	AvgLatency time.Duration
+}
+
+type uploadTuner struct {
+	mu      sync.Mutex
+	threads map[string]int
+}
+
+// UploadTuner remembers a thread count per client. It is halved when an
+// upload ran into FLOOD_WAIT and grows again while parts upload quickly.
+var UploadTuner = &uploadTuner{threads: make(map[string]int)}
+
+func clampThreads(threads int) int {
+	return utils.Max(1, utils.Min(threads, maxUploadThreads))
+}
+
+// clampPartSize rounds the part size down to a size Telegram accepts and
+// raises it when the file would need too many parts.
+func clampPartSize(partSize int, fileSize int64) int {
+	size := minPartSize
+	for size*2 <= partSize && size < maxPartSize {
+		size *= 2
+	}
+	for size < maxPartSize && fileSize > int64(size)*maxUploadParts {
+		size *= 2
+	}
+	return size
+}
+
+// Params resolves the settings for an upload. Values from the request win
+// within bounds, otherwise the learned thread count of the client or the
+// configured defaults are used.
+func (t *uploadTuner) Params(key string, threads, partSize int, fileSize int64) UploadParams {
+	config := utils.GetConfig()
+
+	if partSize <= 0 {
+		partSize = config.UploadPartSize
+	}
+
+	if threads <= 0 {
+		t.mu.Lock()
+		learned, ok := t.threads[key]
+		t.mu.Unlock()
+		if ok {
+			threads = learned
+		} else {
+			threads = config.UploadThreads
+		}
+	}
+
+	return UploadParams{Threads: clampThreads(threads), PartSize: clampPartSize(partSize, fileSize)}
+}
+
+func (t *uploadTuner) Observe(key string, params UploadParams, stats *UploadStats) {
+	if stats.Parts == 0 {
+		return
+	}
+
+	threads := params.Threads
+
+	switch {
+	case stats.FloodWaits > 0 || stats.SlowParts > 0:
+		threads = threads / 2
+	case stats.AvgLatency < fastPart:
+		threads = threads + 2
+	}
+
+	t.mu.Lock()
+	t.threads[key] = utils.Min(clampThreads(threads), utils.GetConfig().UploadThreads)
+	t.mu.Unlock()
+}
+
+// UploadObserver wraps the api used by the uploader and records the latency
+// of every part.
+type UploadObserver struct {
+	api   *tg.Client
+	mu    sync.Mutex
+	total time.Duration
+	stats UploadStats
+}
+
+func NewUploadObserver(api *tg.Client) *UploadObserver {
+	return &UploadObserver{api: api}
+}
+
+func (o *UploadObserver) observe(start time.Time, err error) {
+	elapsed := time.Since(start)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats.Parts++
+	o.total += elapsed
+	if elapsed > slowPart {
+		o.stats.SlowParts++
+	}
+	if _, ok := tgerr.AsFloodWait(err); ok {
+		o.stats.FloodWaits++
+	}
+}
+
+func (o *UploadObserver) UploadSaveFilePart(ctx context.Context, request *tg.UploadSaveFilePartRequest) (bool, error) {
+	start := time.Now()
+	ok, err := o.api.UploadSaveFilePart(ctx, request)
+	o.observe(start, err)
+	return ok, err
+}
+
+func (o *UploadObserver) UploadSaveBigFilePart(ctx context.Context, request *tg.UploadSaveBigFilePartRequest) (bool, error) {
+	start := time.Now()
+	ok, err := o.api.UploadSaveBigFilePart(ctx, request)
+	o.observe(start, err)
+	return ok, err
+}
+
+func (o *UploadObserver) Stats() *UploadStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stats
+	if stats.Parts > 0 {
+		stats.AvgLatency = o.total / time.Duration(stats.Parts)
+	}
+	return &stats
+}
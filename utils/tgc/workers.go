@@ -4,34 +4,83 @@ import (
 	"context"
 	"sync"
 
+	"github.com/divyam234/teldrive/utils"
 	"github.com/gotd/contrib/bg"
 	"github.com/gotd/td/telegram"
+	"go.uber.org/zap"
 )
 
-type BotWorkers struct {
+func sameTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type botPool struct {
 	mu      sync.Mutex
-	bots    map[int64][]string
-	currIdx map[int64]int
+	bots    []string
+	currIdx int
 }
 
-func (w *BotWorkers) Set(bots []string, channelId int64) {
+// BotWorkers keeps one pool of bot tokens per channel.
+type BotWorkers struct {
+	mu    sync.Mutex
+	pools map[int64]*botPool
+}
+
+func (w *BotWorkers) pool(channelId int64) *botPool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	_, ok := w.bots[channelId]
+	if w.pools == nil {
+		w.pools = make(map[int64]*botPool)
+	}
+	p, ok := w.pools[channelId]
 	if !ok {
-		w.bots = make(map[int64][]string)
-		w.currIdx = make(map[int64]int)
-		w.bots[channelId] = bots
-		w.currIdx[channelId] = 0
+		p = &botPool{}
+		w.pools[channelId] = p
+	}
+	return p
+}
+
+// Set reconciles the channel pool with the current bots of the channel.
+func (w *BotWorkers) Set(bots []string, channelId int64) {
+	p := w.pool(channelId)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !sameTokens(p.bots, bots) {
+		p.bots = append([]string{}, bots...)
+		if len(p.bots) > 0 {
+			p.currIdx %= len(p.bots)
+		}
+	}
+}
+
+func (w *BotWorkers) Next(channelId int64) (string, error) {
+	p := w.pool(channelId)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.bots) == 0 {
+		return "", ErrNoHealthyBots
 	}
+	index, err := BotHealth.Pick(p.bots, p.currIdx)
+	if err != nil {
+		return "", err
+	}
+	p.currIdx = (index + 1) % len(p.bots)
+	return p.bots[index], nil
 }
 
-func (w *BotWorkers) Next(channelId int64) string {
+// Drop forgets the pool of a channel.
+func (w *BotWorkers) Drop(channelId int64) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	index := w.currIdx[channelId]
-	w.currIdx[channelId] = (index + 1) % len(w.bots[channelId])
-	return w.bots[channelId][index]
+	delete(w.pools, channelId)
 }
 
 var Workers = &BotWorkers{}
@@ -42,71 +91,143 @@ type Client struct {
 	Status string
 }
 
-type streamWorkers struct {
+func (c *Client) stop() {
+	if c.Status == "running" && c.Stop != nil {
+		c.Stop()
+	}
+}
+
+type streamPool struct {
 	mu      sync.Mutex
-	bots    map[int64][]string
-	clients map[int64][]*Client
-	currIdx map[int64]int
+	tokens  []string
+	bots    []string
+	clients map[string]*Client
+	currIdx int
 }
 
-func (w *streamWorkers) Set(bots []string, channelId int64) {
+// streamWorkers keeps long running bot clients per channel. Clients are
+// connected on first use and stopped when their bot leaves the channel.
+type streamWorkers struct {
+	mu     sync.Mutex
+	pools  map[int64]*streamPool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (w *streamWorkers) pool(channelId int64) (*streamPool, context.Context) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	_, ok := w.bots[channelId]
+	if w.pools == nil {
+		w.pools = make(map[int64]*streamPool)
+		w.ctx, w.cancel = context.WithCancel(context.Background())
+	}
+	p, ok := w.pools[channelId]
 	if !ok {
-		w.bots = make(map[int64][]string)
-		w.clients = make(map[int64][]*Client)
-		w.currIdx = make(map[int64]int)
-		w.bots[channelId] = bots
-		for _, token := range bots {
-			client, _ := BotLogin(context.TODO(), token)
-			w.clients[channelId] = append(w.clients[channelId], &Client{Tg: client, Status: "idle"})
+		p = &streamPool{clients: make(map[string]*Client)}
+		w.pools[channelId] = p
+	}
+	return p, w.ctx
+}
+
+// Set reconciles the channel pool with the current bots of the channel,
+// creating clients for new bots and stopping clients of removed ones.
+// Bots whose client cannot be created are left out of the pool.
+func (w *streamWorkers) Set(bots []string, channelId int64) {
+	p, ctx := w.pool(channelId)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if sameTokens(p.tokens, bots) {
+		return
+	}
+
+	keep := make(map[string]bool, len(bots))
+	usable := make([]string, 0, len(bots))
+	for _, token := range bots {
+		keep[token] = true
+		if _, ok := p.clients[token]; !ok {
+			client, err := BotLogin(ctx, token)
+			if err != nil {
+				utils.Logger.Error("failed to create stream bot client",
+					zap.Int64("bot", BotID(token)), zap.Error(err))
+				continue
+			}
+			p.clients[token] = &Client{Tg: client, Status: "idle"}
 		}
-		w.currIdx[channelId] = 0
+		usable = append(usable, token)
 	}
 
+	for token, client := range p.clients {
+		if !keep[token] {
+			delete(p.clients, token)
+			go client.stop()
+		}
+	}
+
+	p.tokens = append([]string{}, bots...)
+	p.bots = usable
+	if len(p.bots) > 0 {
+		p.currIdx %= len(p.bots)
+	}
 }
 
-func (w *streamWorkers) Next(channelId int64) (*Client, int, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	index := w.currIdx[channelId]
-	nextClient := w.clients[channelId][index]
-	w.currIdx[channelId] = (index + 1) % len(w.clients[channelId])
+// Next returns the client of the next healthy bot of the channel together
+// with its token.
+func (w *streamWorkers) Next(channelId int64) (*Client, string, error) {
+	p, _ := w.pool(channelId)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.bots) == 0 {
+		return nil, "", ErrNoHealthyBots
+	}
+	index, err := BotHealth.Pick(p.bots, p.currIdx)
+	if err != nil {
+		return nil, "", err
+	}
+	token := p.bots[index]
+	nextClient := p.clients[token]
+	p.currIdx = (index + 1) % len(p.bots)
 	if nextClient.Status == "idle" {
 		stop, err := bg.Connect(nextClient.Tg)
 		if err != nil {
-			return nil, 0, err
+			return nil, "", err
 		}
 		nextClient.Stop = stop
 		nextClient.Status = "running"
 	}
-	return nextClient, index, nil
+	return nextClient, token, nil
 }
 
-func (w *streamWorkers) UserWorker(client *telegram.Client) (*Client, error) {
+// Drop stops every client of a channel.
+func (w *streamWorkers) Drop(channelId int64) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	//for user login channelId not needed so we use 1 here
-	channelId := int64(1)
-
-	_, ok := w.clients[channelId]
-
+	p, ok := w.pools[channelId]
+	delete(w.pools, channelId)
+	w.mu.Unlock()
 	if !ok {
-		w.clients = make(map[int64][]*Client)
-		w.clients[channelId] = append(w.clients[channelId], &Client{Tg: client, Status: "idle"})
+		return
 	}
-	nextClient := w.clients[channelId][0]
-	if nextClient.Status == "idle" {
-		stop, err := bg.Connect(nextClient.Tg)
-		if err != nil {
-			return nil, err
-		}
-		nextClient.Stop = stop
-		nextClient.Status = "running"
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, client := range p.clients {
+		go client.stop()
+	}
+}
+
+// Close stops all stream clients on shutdown.
+func (w *streamWorkers) Close() {
+	w.mu.Lock()
+	channels := make([]int64, 0, len(w.pools))
+	for channelId := range w.pools {
+		channels = append(channels, channelId)
+	}
+	if w.cancel != nil {
+		defer w.cancel()
+	}
+	w.mu.Unlock()
+	for _, channelId := range channels {
+		w.Drop(channelId)
 	}
-	return nextClient, nil
 }
 
 var StreamWorkers = &streamWorkers{}
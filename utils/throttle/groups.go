@@ -0,0 +1,52 @@
+package throttle
+
+import (
+	"sync"
+
+	"github.com/divyam234/teldrive/utils"
+	"go.uber.org/zap"
+)
+
+// defaultLimits apply unless overridden through HTTP_RATE_LIMITS. Groups
+// without an entry share the limits of "default".
+var defaultLimits = map[string]string{
+	"default": "50/s",
+	"auth":    "20/m",
+	"authws":  "10/m",
+	"stream":  "0",
+}
+
+var (
+	groupsOnce sync.Once
+	groups     map[string]*Limiter
+)
+
+func loadGroups() {
+	groups = make(map[string]*Limiter)
+
+	specs := make(map[string]string)
+	for name, spec := range defaultLimits {
+		specs[name] = spec
+	}
+	for name, spec := range utils.GetConfig().HttpRateLimits {
+		specs[name] = spec
+	}
+
+	for name, spec := range specs {
+		limiter, err := Parse(spec)
+		if err != nil {
+			utils.Logger.Error("invalid rate limit", zap.String("group", name), zap.Error(err))
+			continue
+		}
+		groups[name] = limiter
+	}
+}
+
+// Group returns the limiter for a route group, nil when it is unlimited.
+func Group(name string) *Limiter {
+	groupsOnce.Do(loadGroups)
+	if limiter, ok := groups[name]; ok {
+		return limiter
+	}
+	return groups["default"]
+}
@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type entry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter is a token bucket per key, idle keys are dropped after ten minutes.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	entries map[string]*entry
+}
+
+func New(limit rate.Limit, burst int) *Limiter {
+	l := &Limiter{limit: limit, burst: burst, entries: make(map[string]*entry)}
+	go l.cleanup()
+	return l
+}
+
+// Parse builds a limiter from a spec like "20/s", "10/m" or "100/h". The
+// request count doubles as burst size. An empty or zero spec means no limit.
+func Parse(spec string) (*Limiter, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" {
+		return nil, nil
+	}
+
+	count, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid rate limit %q", spec)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid rate limit %q", spec)
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return nil, fmt.Errorf("invalid rate limit unit %q", unit)
+	}
+
+	return New(rate.Every(period/time.Duration(n)), n), nil
+}
+
+// Allow reports whether a request for key may proceed and, if not, how long
+// the caller should wait.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.entries[key] = e
+	}
+	e.lastSeen = time.Now()
+	l.mu.Unlock()
+
+	r := e.limiter.Reserve()
+	if delay := r.Delay(); delay > 0 {
+		r.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+func (l *Limiter) cleanup() {
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for key, e := range l.entries {
+			if time.Since(e.lastSeen) > 10*time.Minute {
+				delete(l.entries, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
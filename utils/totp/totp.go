@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Codes follow RFC 6238 with the parameters every authenticator app
+// understands: HMAC-SHA1, 30 second steps and 6 digits.
+const (
+	period = 30
+	digits = 6
+	skew   = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("period", fmt.Sprint(period))
+	params.Set("digits", fmt.Sprint(digits))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func code(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000)
+}
+
+// Validate checks passcode against the secret allowing one step of clock
+// drift in either direction.
+func Validate(secret, passcode string, now time.Time) bool {
+	_, ok := ValidateStep(secret, passcode, now)
+	return ok
+}
+
+// ValidateStep is Validate returning the time step the passcode belongs to,
+// callers store it to refuse the same or an older code again.
+func ValidateStep(secret, passcode string, now time.Time) (int64, bool) {
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != digits {
+		return 0, false
+	}
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	counter := now.Unix() / period
+	for i := -skew; i <= skew; i++ {
+		step := counter + int64(i)
+		if subtle.ConstantTimeCompare([]byte(code(key, uint64(step))), []byte(passcode)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateRFCVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if !Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0)) {
+			t.Errorf("Validate(%q) at %d = false, want true", tt.code, tt.unix)
+		}
+	}
+}
+
+func TestValidateStepEdges(t *testing.T) {
+	key, err := encoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const step = 50000000
+
+	passcode := code(key, step)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		ok   bool
+	}{
+		{"two steps early", time.Unix((step-2)*period+period-1, 0), false},
+		{"start of previous step", time.Unix((step-1)*period, 0), true},
+		{"end of previous step", time.Unix((step-1)*period+period-1, 0), true},
+		{"start of step", time.Unix(step*period, 0), true},
+		{"end of step", time.Unix(step*period+period-1, 0), true},
+		{"start of next step", time.Unix((step+1)*period, 0), true},
+		{"end of next step", time.Unix((step+1)*period+period-1, 0), true},
+		{"two steps late", time.Unix((step+2)*period, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateStep(rfcSecret, passcode, tt.now)
+			if ok != tt.ok {
+				t.Fatalf("ValidateStep() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != step {
+				t.Errorf("ValidateStep() step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name     string
+		secret   string
+		passcode string
+	}{
+		{"wrong code", rfcSecret, "287083"},
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "2870820"},
+		{"empty code", rfcSecret, ""},
+		{"invalid secret", "not base32!", "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Validate(tt.secret, tt.passcode, now) {
+				t.Errorf("Validate(%q, %q) = true, want false", tt.secret, tt.passcode)
+			}
+		})
+	}
+}